@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	analysisSuffix        = ".analysis.json"
+	clippingOverlaySuffix = ".clipping.png"
+
+	// Channel values treated as clipped. JPEG compression rarely leaves a
+	// clipped area at exactly 0 or 255.
+	highlightClipLevel = 254
+	shadowClipLevel    = 1
+)
+
+var (
+	highlightOverlayColor = color.NRGBA{R: 255, A: 255}
+	shadowOverlayColor    = color.NRGBA{B: 255, A: 255}
+)
+
+type ImageAnalysis struct {
+	Hash   string `json:"hash"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Red    []int  `json:"red"`
+	Green  []int  `json:"green"`
+	Blue   []int  `json:"blue"`
+	Luma   []int  `json:"luma"`
+	// Percentage of pixels with any channel at the highlight clip level
+	HighlightsClipped float64 `json:"highlights_clipped"`
+	// Percentage of pixels with every channel at the shadow clip level
+	ShadowsClipped float64 `json:"shadows_clipped"`
+	OverlayURL     string  `json:"overlay_url,omitempty"`
+}
+
+func overlayURL(hash string) string {
+	return "/overlay/" + hash + ".png"
+}
+
+// analyzeImage computes the histograms and clipped pixels of img, and a
+// clipping overlay when asked for, transparent except for clipped pixels
+func analyzeImage(img image.Image, withOverlay bool) (ImageAnalysis, *image.NRGBA) {
+	rgba := toRGBA(img)
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+
+	analysis := ImageAnalysis{
+		Width:  width,
+		Height: height,
+		Red:    make([]int, 256),
+		Green:  make([]int, 256),
+		Blue:   make([]int, 256),
+		Luma:   make([]int, 256),
+	}
+
+	var overlay *image.NRGBA
+	if withOverlay {
+		overlay = image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+
+	var highlights, shadows int
+	for y := 0; y < height; y++ {
+		row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+width*4]
+		for x := 0; x < width; x++ {
+			r, g, b := row[x*4], row[x*4+1], row[x*4+2]
+
+			analysis.Red[r]++
+			analysis.Green[g]++
+			analysis.Blue[b]++
+			// Rec. 709 luma
+			analysis.Luma[(54*int(r)+183*int(g)+19*int(b))>>8]++
+
+			switch {
+			case r >= highlightClipLevel || g >= highlightClipLevel || b >= highlightClipLevel:
+				highlights++
+				if overlay != nil {
+					overlay.SetNRGBA(x, y, highlightOverlayColor)
+				}
+			case r <= shadowClipLevel && g <= shadowClipLevel && b <= shadowClipLevel:
+				shadows++
+				if overlay != nil {
+					overlay.SetNRGBA(x, y, shadowOverlayColor)
+				}
+			}
+		}
+	}
+
+	if pixels := width * height; pixels > 0 {
+		analysis.HighlightsClipped = 100 * float64(highlights) / float64(pixels)
+		analysis.ShadowsClipped = 100 * float64(shadows) / float64(pixels)
+	}
+
+	return analysis, overlay
+}
+
+// AnalyzePreview returns the histograms and clipping of the preview of a
+// file, and when overlay is set the URL of a PNG marking clipped highlights
+// in red and clipped shadows in blue. Results are cached with the thumbnail.
+func (a *App) AnalyzePreview(path string, overlay bool) (ImageAnalysis, error) {
+	source := a.browsedSource()
+
+	preview, err := a.getSourcePreview(path, source)
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+	if !preview.PreviewAvailable {
+		return ImageAnalysis{}, errNoPreview
+	}
+
+	hash := preview.Hash
+	cacheDir := thumbnailCacheDir()
+	analysisPath := filepath.Join(cacheDir, hash+analysisSuffix)
+	overlayPath := filepath.Join(cacheDir, hash+clippingOverlaySuffix)
+
+	var analysis ImageAnalysis
+	cached := false
+	if data, err := os.ReadFile(analysisPath); err == nil && json.Unmarshal(data, &analysis) == nil {
+		cached = true
+	}
+
+	needOverlay := false
+	if overlay {
+		_, err := os.Stat(overlayPath)
+		needOverlay = err != nil
+	}
+
+	a.cache.lookup(CacheKindThumbnail, hash+analysisSuffix, cached && !needOverlay)
+	if cached && !needOverlay {
+		if overlay {
+			analysis.OverlayURL = overlayURL(hash)
+		}
+		return analysis, nil
+	}
+
+	data, err := os.ReadFile(preview.PreviewPath)
+	if err != nil {
+		return ImageAnalysis{}, fmt.Errorf("failed to read preview: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageAnalysis{}, fmt.Errorf("failed to decode preview: %v", err)
+	}
+
+	analysis, overlayImage := analyzeImage(img, needOverlay)
+	analysis.Hash = hash
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return ImageAnalysis{}, fmt.Errorf("failed to create thumbnail directory: %v", err)
+	}
+
+	encoded, err := json.Marshal(analysis)
+	if err != nil {
+		return ImageAnalysis{}, fmt.Errorf("failed to encode analysis: %v", err)
+	}
+
+	if err := writeFileAtomic(analysisPath, encoded, 0644); err != nil {
+		rt.LogWarningf(a.ctx, "failed to cache analysis for %q: %v", path, err)
+	} else {
+		a.cache.add(CacheKindThumbnail, hash, hash+analysisSuffix, source)
+	}
+
+	if overlayImage != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, overlayImage); err != nil {
+			return ImageAnalysis{}, fmt.Errorf("failed to encode clipping overlay: %v", err)
+		}
+
+		if err := writeFileAtomic(overlayPath, buf.Bytes(), 0644); err != nil {
+			return ImageAnalysis{}, fmt.Errorf("failed to write clipping overlay: %v", err)
+		}
+
+		a.cache.add(CacheKindThumbnail, hash, hash+clippingOverlaySuffix, source)
+	}
+
+	if overlay {
+		analysis.OverlayURL = overlayURL(hash)
+	}
+
+	return analysis, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	wailsconfigstore "github.com/AndreiTelteu/wails-configstore"
@@ -28,6 +30,17 @@ var exiftool_path string
 type App struct {
 	ctx         context.Context
 	configStore *wailsconfigstore.ConfigStore
+
+	thumbnailJobMu sync.Mutex
+	thumbnailJob   *thumbnailJob
+	currentSource  string
+
+	cache         *cacheIndex
+	imports       importQueue
+	importTracker importTracker
+	cameras       cameraDetection
+
+	stopDiskWatch context.CancelFunc
 }
 
 // NewApp creates a new App application struct
@@ -40,6 +53,7 @@ func NewApp() *App {
 
 	return &App{
 		configStore: configStore,
+		cache:       newCacheIndex(),
 	}
 }
 
@@ -47,21 +61,34 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-
-	exiftoolPath, err := extractPlatformSpecificExiftool()
-	if err != nil {
-		log.Fatalf("Failed to extract exiftool: %v", err)
+	a.cache.load(ctx)
+
+	var configuredExiftool string
+	cacheMaxSize := defaultCacheMaxSize
+	if configState := a.GetConfig(); configState != nil {
+		configuredExiftool = configState.ExiftoolPath
+		if configState.CacheMaxSize > 0 {
+			cacheMaxSize = configState.CacheMaxSize
+		}
 	}
 
-	exiftool_path = exiftoolPath
+	a.useExiftool(configuredExiftool)
+	a.cache.setMaxBytes(int64(cacheMaxSize) * 1024 * 1024)
+
+	go a.pruneCameraStaging()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	a.stopDiskWatch = cancel
+	go a.watchDisks(watchCtx)
 }
 
 func (a *App) shutdown(ctx context.Context) {
-	if exiftool_path != "" {
-		// Clean up the extracted exiftool
-		if err := os.RemoveAll(filepath.Join(exiftool_path, "..")); err != nil {
-			log.Printf("Failed to remove extracted exiftool: %v", err)
-		}
+	if a.stopDiskWatch != nil {
+		a.stopDiskWatch()
+	}
+
+	if err := a.cache.save(); err != nil {
+		rt.LogErrorf(ctx, "failed to save the cache index: %v", err)
 	}
 }
 
@@ -75,33 +102,124 @@ var (
 )
 
 type FileInfo struct {
-	Path     string `json:"path"`
-	IsFile   bool   `json:"is_file"`
-	Size     int64  `json:"size"`
-	MimeType string `json:"mime_type"`
-	Filename string `json:"filename"`
+	Path      string  `json:"path"`
+	IsFile    bool    `json:"is_file"`
+	Size      int64   `json:"size"`
+	MimeType  string  `json:"mime_type"`
+	Filename  string  `json:"filename"`
+	Sharpness float64 `json:"sharpness,omitempty"`
+	ClusterID int     `json:"cluster_id,omitempty"`
+	// AlreadyImported is set when the file was imported from the same card
+	// before
+	AlreadyImported bool `json:"already_imported"`
+	// Suspicious is set for files that look damaged, with the reasons in
+	// Warnings. They are never deleted after an import.
+	Suspicious bool     `json:"suspicious,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
 }
 
 type ThumbnailResponse struct {
-	ThumbnailPath string `json:"thumbnail_path"`
-	OriginalPath  string `json:"original_path"`
-	Hash          string `json:"hash"`
+	ThumbnailPath    string `json:"thumbnail_path"`
+	URL              string `json:"url"`
+	OriginalPath     string `json:"original_path"`
+	Hash             string `json:"hash"`
+	PreviewAvailable bool   `json:"preview_available"`
+	PreviewSource    string `json:"preview_source,omitempty"`
+	Orientation      int    `json:"orientation"`
+	PerceptualHash   string `json:"perceptual_hash,omitempty"`
 }
 
 type Config struct {
-	SourceDisk              string `json:"sourceDisk"`
-	Location                string `json:"location"`
-	CreateSubFoldersPattern string `json:"createSubFoldersPattern"`
-	CustomSubFolderName     string `json:"customSubFolderName"`
-	ConvertToDng            bool   `json:"convertToDng"`
-	DeleteOriginal          bool   `json:"deleteOriginal"`
-	JpegPreviewSize         string `json:"jpegPreviewSize"`
-	CompressedLossless      bool   `json:"compressedLossless"`
-	ImageConversionMethod   string `json:"imageConversionMethod"`
-	EmbedOriginalRawFile    bool   `json:"embedOriginalRawFile"`
+	SourceDisk              string          `json:"sourceDisk"`
+	Location                string          `json:"location"`
+	CreateSubFoldersPattern string          `json:"createSubFoldersPattern"`
+	CustomSubFolderName     string          `json:"customSubFolderName"`
+	ConvertToDng            bool            `json:"convertToDng"`
+	DeleteOriginal          bool            `json:"deleteOriginal"`
+	JpegPreviewSize         string          `json:"jpegPreviewSize"`
+	CompressedLossless      bool            `json:"compressedLossless"`
+	ImageConversionMethod   string          `json:"imageConversionMethod"`
+	EmbedOriginalRawFile    bool            `json:"embedOriginalRawFile"`
+	GpxFiles                []string        `json:"gpxFiles"`
+	GeotagMaxGap            int             `json:"geotagMaxGap"`
+	GeotagTimeOffset        int             `json:"geotagTimeOffset"`
+	GeotagTimezone          string          `json:"geotagTimezone"`
+	GeotagWriteSidecar      bool            `json:"geotagWriteSidecar"`
+	ExiftoolPath            string          `json:"exiftoolPath"`
+	CacheMaxSize            int             `json:"cacheMaxSize"`
+	AutoOpenNewCard         bool            `json:"autoOpenNewCard"`
+	EjectWhenDone           bool            `json:"ejectWhenDone"`
+	ImportParallel          bool            `json:"importParallel"`
+	QueueNewCards           bool            `json:"queueNewCards"`
+	VirtualSources          []VirtualSource `json:"virtualSources"`
+	// DefaultSelection is what is selected when a card is opened: all, none
+	// or new files
+	DefaultSelection string `json:"defaultSelection"`
+}
+
+const (
+	ImportStatusImported   = "imported"
+	ImportStatusUnreadable = "unreadable"
+)
+
+type ImportedFile struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Geotagged   bool   `json:"geotagged"`
+	Status      string `json:"status"`
+	// Retries is how many times reading the original failed before it
+	// was read, or before giving up when it is unreadable
+	Retries int `json:"retries,omitempty"`
+	// Error is why an unreadable file was not imported, or why an imported
+	// one could not be geotagged
+	Error string `json:"error,omitempty"`
+	// KeptOriginal is set when the original was not deleted because it
+	// looks damaged, for the reasons in Warnings
+	KeptOriginal bool     `json:"kept_original,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+
+	// cameraSize is the size the camera listed for files imported from one,
+	// which identifies them in the import history
+	cameraSize int64
+}
+
+type ImportReport struct {
+	Files           []ImportedFile `json:"files"`
+	GeotagUnmatched []string       `json:"geotag_unmatched"`
+	Ejected         bool           `json:"ejected"`
+	EjectError      string         `json:"eject_error,omitempty"`
+}
+
+// complete reports whether every file was imported
+func (r ImportReport) complete() bool {
+	for _, file := range r.Files {
+		if file.Status != ImportStatusImported {
+			return false
+		}
+	}
+	return true
 }
 
 func (a *App) ListFiles(drivePath string) ([]FileInfo, error) {
+	a.setCurrentSource(drivePath)
+
+	files, err := a.listSourceFiles(drivePath)
+	if err != nil {
+		return files, err
+	}
+
+	a.markImported(drivePath, files)
+	flagSuspicious(files, sizeWarnings(files))
+
+	return files, nil
+}
+
+// listSourceFiles lists the raw files under drivePath, skipping hidden ones
+func (a *App) listSourceFiles(drivePath string) ([]FileInfo, error) {
+	if isCameraPath(drivePath) {
+		return a.listCameraFiles(drivePath)
+	}
+
 	var files []FileInfo
 
 	err := filepath.Walk(drivePath, func(path string, info os.FileInfo, err error) error {
@@ -177,27 +295,48 @@ func formatDateFolder(shotDate string, formatArg string) string {
 	}
 }
 
+var shotDateRegexp = regexp.MustCompile(`(\d{4}):(\d{2}):(\d{2})`)
+
+func parseShotDate(dateStr string) (string, bool) {
+	matches := shotDateRegexp.FindStringSubmatch(dateStr)
+	if len(matches) == 4 {
+		return fmt.Sprintf("%s-%s-%s", matches[1], matches[2], matches[3]), true
+	}
+	return "", false
+}
+
 func (a *App) GetShotDate(filePath string) (string, error) {
-	cmd := exec.Command(exiftool_path, "-DateTimeOriginal", "-s3", filePath)
+	// Read the date natively where possible, exiftool is the fallback for
+	// formats the native reader does not support
+	if meta, err := readRawMetadata(filePath); err == nil {
+		if shotDate, ok := parseShotDate(meta.DateTimeOriginal); ok {
+			return shotDate, nil
+		}
+	}
+
+	cmd, err := exiftoolCommand("-DateTimeOriginal", "-s3", filePath)
+	if err != nil {
+		return "", err
+	}
+
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to execute exiftool: %v", err)
 	}
 
-	dateStr := strings.TrimSpace(string(output))
-	re := regexp.MustCompile(`(\d{4}):(\d{2}):(\d{2})`)
-	matches := re.FindStringSubmatch(dateStr)
-
-	if len(matches) == 4 {
-		return fmt.Sprintf("%s-%s-%s", matches[1], matches[2], matches[3]), nil
+	if shotDate, ok := parseShotDate(strings.TrimSpace(string(output))); ok {
+		return shotDate, nil
 	}
 
 	return "", fmt.Errorf("failed to extract shot date")
 }
 
 func (a *App) GetDngArgs() []string {
-	configState := a.GetConfig()
+	return dngArgsFor(a.GetConfig())
+}
 
+// dngArgsFor returns the DNG Converter arguments for the settings of a config
+func dngArgsFor(configState *Config) []string {
 	var dngArgs []string
 
 	switch configState.JpegPreviewSize {
@@ -230,29 +369,101 @@ func (a *App) GetDngArgs() []string {
 
 // TODO: rename to import
 // TODO: fetch all args from the settings file
-func (a *App) CopyOrConvert(files []string) error {
+func (a *App) CopyOrConvert(files []string) (ImportReport, error) {
 	configState := a.GetConfig()
+	if configState == nil {
+		return ImportReport{}, fmt.Errorf("could not read the config")
+	}
+
+	source := a.browsedSource()
+	if source == "" {
+		source = configState.SourceDisk
+	}
+
+	ctx, done := a.trackImport(a.ctx, source)
+	defer done()
+
+	report, err := a.runImport(ctx, configState, files, nil)
+	if source != "" {
+		a.recordImports(source, report.Files)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	// Only reached when every file was read
+	if configState.EjectWhenDone && report.complete() && source != "" && !a.isVirtualSource(source) && !isCameraPath(source) {
+		if err := a.EjectDisk(source); err != nil {
+			report.EjectError = err.Error()
+		} else {
+			report.Ejected = true
+		}
+	}
+
+	return report, nil
+}
+
+// runImport copies or converts files with the settings of configState,
+// calling progress after each file. It stops between files when ctx is done.
+func (a *App) runImport(ctx context.Context, configState *Config, files []string, progress func(imported ImportedFile)) (ImportReport, error) {
+	var report ImportReport
+
 	rt.LogInfof(a.ctx, "Starting import of %d files to %s", len(files), configState.Location)
 
-	dngArgs := a.GetDngArgs()
+	dngArgs := dngArgsFor(configState)
+
+	var tagger *geotagger
+	if len(configState.GpxFiles) > 0 {
+		var err error
+		tagger, err = newGeotagger(configState)
+		if err != nil {
+			rt.LogErrorf(a.ctx, "Failed to load GPX tracks: %v", err)
+			return report, fmt.Errorf("failed to load GPX tracks: %v", err)
+		}
+	}
+
+	// Damaged files are kept on the card, where they may still be recovered
+	var suspicious map[string][]string
+	if configState.DeleteOriginal {
+		suspicious = a.suspiciousImports(files)
+		if len(suspicious) > 0 {
+			rt.LogWarningf(a.ctx, "Keeping the originals of %d files that look damaged", len(suspicious))
+		}
+	}
 
 	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			rt.LogInfof(a.ctx, "Import stopped after %d of %d files: %v", len(report.Files), len(files), context.Cause(ctx))
+			return report, importStopped(ctx, file)
+		}
+
 		rt.LogDebugf(a.ctx, "Processing file: %s", file)
 
+		// Files on cameras are imported from a downloaded copy
+		source := file
+		if isCameraPath(source) {
+			staged, err := stageCameraFile(ctx, source)
+			if err != nil {
+				rt.LogErrorf(a.ctx, "Failed to download %s: %v", source, err)
+				return report, err
+			}
+			file = staged
+		}
+
 		destDir := configState.Location
 
 		if configState.CreateSubFoldersPattern != "none" && configState.CreateSubFoldersPattern != "custom" {
 			shotDate, err := a.GetShotDate(file)
 			if err != nil {
 				rt.LogErrorf(a.ctx, "Failed to get shot date for %s: %v", file, err)
-				return err
+				return report, err
 			}
 
 			destDir = filepath.Join(configState.Location, formatDateFolder(shotDate, configState.CreateSubFoldersPattern))
 			err = os.MkdirAll(destDir, 0755)
 			if err != nil {
 				rt.LogErrorf(a.ctx, "Failed to create directory %s: %v", destDir, err)
-				return fmt.Errorf("failed to create destination directory: %v", err)
+				return report, fmt.Errorf("failed to create destination directory: %v", err)
 			}
 		}
 
@@ -265,11 +476,19 @@ func (a *App) CopyOrConvert(files []string) error {
 			err := os.MkdirAll(destDir, 0755)
 			if err != nil {
 				rt.LogErrorf(a.ctx, "Failed to create directory %s: %v", destDir, err)
-				return fmt.Errorf("failed to create destination directory: %v", err)
+				return report, fmt.Errorf("failed to create destination directory: %v", err)
 			}
 		}
 
+		var destPath string
+		var retries int
+
+		var readErr error
+
 		if configState.ConvertToDng {
+			filename := filepath.Base(file)
+			destPath = filepath.Join(destDir, strings.TrimSuffix(filename, filepath.Ext(filename))+".dng")
+
 			var cmd *exec.Cmd
 			if runtime.GOOS == "windows" {
 				cmd = exec.Command("C:\\Program Files\\Adobe\\Adobe DNG Converter\\Adobe DNG Converter.exe",
@@ -287,33 +506,143 @@ func (a *App) CopyOrConvert(files []string) error {
 			rt.LogDebugf(a.ctx, "Converting to DNG: %s", cmd.String())
 			output, err := cmd.CombinedOutput()
 			if err != nil {
-				rt.LogErrorf(a.ctx, "DNG conversion failed for %s: %v", file, err)
-				return fmt.Errorf("DNG Converter failed: %v, command: %s, output: %s", err, cmd.String(), string(output))
+				// The converter does not tell read errors from others, so
+				// the original is read through, retrying transient errors.
+				// When reading it needed retries the card may have failed
+				// the converter's read, which is tried once more.
+				_, retries, readErr = hashFileRetrying(ctx, file)
+				if readErr == nil && retries > 0 {
+					rt.LogWarningf(a.ctx, "Converting %s again after %d failed reads", file, retries)
+					output, err = exec.Command(cmd.Path, cmd.Args[1:]...).CombinedOutput()
+				}
+				if readErr == nil && err != nil {
+					rt.LogErrorf(a.ctx, "DNG conversion failed for %s: %v", file, err)
+					return report, fmt.Errorf("DNG Converter failed: %v, command: %s, output: %s", err, cmd.String(), string(output))
+				}
+			}
+			if readErr == nil {
+				rt.LogDebugf(a.ctx, "DNG conversion completed for: %s", file)
+			}
+
+			// The original is only deleted once the DNG is known to be written
+			if readErr == nil && configState.DeleteOriginal {
+				if info, err := os.Stat(destPath); err != nil || info.Size() == 0 {
+					rt.LogErrorf(a.ctx, "DNG Converter wrote no data to %s", destPath)
+					return report, fmt.Errorf("DNG Converter did not write %s, keeping the original", destPath)
+				}
 			}
-			rt.LogDebugf(a.ctx, "DNG conversion completed for: %s", file)
 		} else {
 			filename := filepath.Base(file)
-			destPath := filepath.Join(destDir, filename)
+			destPath = filepath.Join(destDir, filename)
 
 			rt.LogDebugf(a.ctx, "Copying file to: %s", destPath)
-			err := copyFile(file, destPath)
-			if err != nil {
-				rt.LogErrorf(a.ctx, "Failed to copy %s: %v", file, err)
-				return fmt.Errorf("failed to copy file: %v", err)
+			var data []byte
+			data, retries, readErr = readFileRetrying(ctx, file)
+			if readErr == nil {
+				if err := os.WriteFile(destPath, data, 0644); err != nil {
+					rt.LogErrorf(a.ctx, "Failed to copy %s: %v", file, err)
+					return report, fmt.Errorf("failed to copy file: %v", err)
+				}
+
+				// The original is only deleted once the copy is known to be
+				// intact, and a copy that needed retries is always checked
+				if configState.DeleteOriginal || retries > 0 {
+					readErr = verifyCopy(ctx, file, destPath)
+					if readErr != nil {
+						os.Remove(destPath)
+					}
+				}
 			}
 		}
 
-		if configState.DeleteOriginal {
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return report, importStopped(ctx, file)
+			}
+			if isDiskGoneError(readErr) {
+				rt.LogErrorf(a.ctx, "Lost the disk while reading %s: %v", file, readErr)
+				return report, fmt.Errorf("failed to read %s: %w", source, errDiskRemoved)
+			}
+
+			// Carry on with the other files, keeping the original
+			rt.LogErrorf(a.ctx, "Failed to read %s after %d failed reads: %v", file, retries, readErr)
+			unreadable := ImportedFile{
+				Source:  source,
+				Status:  ImportStatusUnreadable,
+				Retries: retries,
+				Error:   readErr.Error(),
+			}
+			report.Files = append(report.Files, unreadable)
+			if progress != nil {
+				progress(unreadable)
+			}
+			if isCameraPath(source) {
+				unstageCameraFile(source)
+			}
+			continue
+		}
+		if retries > 0 {
+			rt.LogWarningf(a.ctx, "Read %s after %d failed reads", file, retries)
+		}
+
+		imported := ImportedFile{
+			Source:      source,
+			Destination: destPath,
+			Status:      ImportStatusImported,
+			Retries:     retries,
+			Warnings:    suspicious[source],
+		}
+		if isCameraPath(source) {
+			if _, _, listed, err := statCameraFile(ctx, source); err == nil {
+				imported.cameraSize = listed.Size
+			}
+		}
+
+		if tagger != nil {
+			// Failures are reported with the file, as they are not misses
+			tagged, err := tagger.tag(file, destPath)
+			switch {
+			case err != nil:
+				rt.LogErrorf(a.ctx, "Failed to geotag %s: %v", destPath, err)
+				imported.Error = fmt.Sprintf("failed to geotag: %v", err)
+			case !tagged:
+				rt.LogWarningf(a.ctx, "No track point matched %s", source)
+				report.GeotagUnmatched = append(report.GeotagUnmatched, source)
+			}
+			imported.Geotagged = tagged
+		}
+
+		imported.KeptOriginal = configState.DeleteOriginal && len(imported.Warnings) > 0
+		report.Files = append(report.Files, imported)
+
+		if imported.KeptOriginal {
+			rt.LogWarningf(a.ctx, "Not deleting %s, which looks damaged: %s", source, strings.Join(imported.Warnings, "; "))
+		} else if configState.DeleteOriginal && isCameraPath(source) {
+			rt.LogDebugf(a.ctx, "Deleting original file from the camera: %s", source)
+			if err := deleteCameraFile(ctx, source); err != nil {
+				rt.LogErrorf(a.ctx, "Failed to delete original file %s: %v", source, err)
+				return report, fmt.Errorf("failed to delete original file: %v", err)
+			}
+		} else if configState.DeleteOriginal {
 			rt.LogDebugf(a.ctx, "Deleting original file: %s", file)
 			if err := os.Remove(file); err != nil {
 				rt.LogErrorf(a.ctx, "Failed to delete original file %s: %v", file, err)
-				return fmt.Errorf("failed to delete original file: %v", err)
+				return report, fmt.Errorf("failed to delete original file: %v", err)
 			}
 		}
+
+		// The download is not needed once the file is imported
+		if isCameraPath(source) {
+			unstageCameraFile(source)
+		}
+
+		if progress != nil {
+			progress(imported)
+		}
 	}
 
 	rt.LogInfof(a.ctx, "Successfully processed %d files", len(files))
-	return nil
+	return report, nil
 }
 
 func copyFile(src, dst string) error {
@@ -325,52 +654,146 @@ func copyFile(src, dst string) error {
 	return os.WriteFile(dst, input, 0644)
 }
 
+func thumbnailCacheDir() string {
+	return filepath.Join(xdg.CacheHome, "PhotoImporter", "thumbnails")
+}
+
 func (a *App) ExtractThumbnail(path string) (ThumbnailResponse, error) {
-	thumbnailDir := xdg.CacheHome
-	thumbnailDir = filepath.Join(thumbnailDir, "PhotoImporter", "thumbnails")
+	return a.extractSourceThumbnail(path, a.browsedSource())
+}
 
-	// Compute file hash
-	hash, err := hashFile(path)
+// extractSourceThumbnail extracts the thumbnail of a file of source, which the
+// cache entries are tagged with
+func (a *App) extractSourceThumbnail(path string, source string) (ThumbnailResponse, error) {
+	if !isCameraPath(path) {
+		return a.extractThumbnail(path, source)
+	}
+
+	// Files on cameras are read from a downloaded copy
+	staged, err := stageCameraFile(a.ctx, path)
 	if err != nil {
 		return ThumbnailResponse{}, err
 	}
 
-	// Create thumbnail filename
-	originalFilename := filepath.Base(path)
-	filenameWithoutExt := strings.TrimSuffix(originalFilename, filepath.Ext(originalFilename))
-	thumbnailPath := filepath.Join(thumbnailDir, fmt.Sprintf("%s_%s.jpg", filenameWithoutExt, hash))
+	response, err := a.extractThumbnail(staged, source)
+	response.OriginalPath = path
+	return response, err
+}
+
+func (a *App) extractThumbnail(path string, source string) (ThumbnailResponse, error) {
+	thumbnailDir := thumbnailCacheDir()
+
+	// Identify the file without reading all of it
+	hash, err := quickFileID(path)
+	if err != nil {
+		return ThumbnailResponse{}, err
+	}
+
+	// Thumbnails are named after the hash so they can be served by hash
+	thumbnailPath := filepath.Join(thumbnailDir, hash+".jpg")
 
 	// Check if thumbnail exists
-	if _, err := os.Stat(thumbnailPath); err == nil {
-		rt.LogErrorf(a.ctx, "thumbnail for %q, with hash %q already exists at %q", path, hash, thumbnailPath)
+	_, err = os.Stat(thumbnailPath)
+	a.cache.lookup(CacheKindThumbnail, hash+".jpg", err == nil)
+	if err == nil {
+		rt.LogDebugf(a.ctx, "thumbnail for %q, with hash %q already exists at %q", path, hash, thumbnailPath)
+
+		// The orientation is kept in the index, as reading it opens the
+		// original
+		orientation := a.cache.orientation(CacheKindThumbnail, hash+".jpg")
+		if orientation == 0 {
+			orientation = readOrientation(path)
+			a.cache.setOrientation(CacheKindThumbnail, hash+".jpg", orientation)
+		}
+
+		perceptualHash, err := a.thumbnailDHash(hash, source)
+		if err != nil {
+			rt.LogWarningf(a.ctx, "failed to compute the perceptual hash of %q: %v", path, err)
+		}
 
 		return ThumbnailResponse{
-			ThumbnailPath: thumbnailPath,
-			OriginalPath:  path,
-			Hash:          hash,
+			ThumbnailPath:    thumbnailPath,
+			URL:              thumbnailURL(hash),
+			OriginalPath:     path,
+			Hash:             hash,
+			PreviewAvailable: true,
+			Orientation:      orientation,
+			PerceptualHash:   perceptualHash,
 		}, nil
 	}
 
-	// Extract thumbnail using exiftool
-	cmd := exec.Command(exiftool_path,
-		"-thumbnailimage",
-		"-b",
-		"-w",
-		filepath.Join(thumbnailDir, "%f_"+hash+".jpg"),
-		path)
+	orientation := readOrientation(path)
+
+	data, previewSource, err := extractThumbnailData(path)
+	if errors.Is(err, errNoPreview) {
+		rt.LogWarningf(a.ctx, "no preview available for %q", path)
 
-	output, err := cmd.CombinedOutput()
+		return ThumbnailResponse{
+			OriginalPath: path,
+			Hash:         hash,
+			Orientation:  orientation,
+		}, nil
+	}
 	if err != nil {
-		rt.LogErrorf(a.ctx, "exiftool failed: %v, output: %s", err, string(output))
+		rt.LogErrorf(a.ctx, "failed to extract thumbnail for %q: %v", path, err)
+		return ThumbnailResponse{}, err
+	}
+
+	// Embedded previews are stored unrotated
+	if oriented, err := orientJPEG(data, orientation); err == nil {
+		data = oriented
+	} else {
+		rt.LogWarningf(a.ctx, "failed to apply orientation %d to thumbnail for %q: %v", orientation, path, err)
+	}
+
+	if err := os.MkdirAll(thumbnailDir, 0755); err != nil {
+		return ThumbnailResponse{}, fmt.Errorf("failed to create thumbnail directory: %v", err)
+	}
+
+	if err := writeFileAtomic(thumbnailPath, data, 0644); err != nil {
+		return ThumbnailResponse{}, fmt.Errorf("failed to write thumbnail: %v", err)
+	}
+
+	a.cache.add(CacheKindThumbnail, hash, hash+".jpg", source)
+	a.cache.setOrientation(CacheKindThumbnail, hash+".jpg", orientation)
+
+	perceptualHash, err := a.thumbnailDHash(hash, source)
+	if err != nil {
+		rt.LogWarningf(a.ctx, "failed to compute the perceptual hash of %q: %v", path, err)
 	}
 
 	return ThumbnailResponse{
-		ThumbnailPath: thumbnailPath,
-		OriginalPath:  path,
-		Hash:          hash,
+		ThumbnailPath:    thumbnailPath,
+		URL:              thumbnailURL(hash),
+		OriginalPath:     path,
+		Hash:             hash,
+		PreviewAvailable: true,
+		PreviewSource:    previewSource,
+		Orientation:      orientation,
+		PerceptualHash:   perceptualHash,
 	}, nil
 }
 
+// verifyCopy checks that dst has the same content as src
+func verifyCopy(ctx context.Context, src, dst string) error {
+	srcHash, _, err := hashFileRetrying(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", src, err)
+	}
+
+	dstHash, err := hashFile(dst)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %v", dst, err)
+	}
+
+	if srcHash != dstHash {
+		return fmt.Errorf("copy of %s does not match the original", src)
+	}
+
+	return nil
+}
+
+// hashFile hashes the full content of a file
 func hashFile(filepath string) (string, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -432,7 +855,7 @@ func (a *App) PictureDir() string {
 }
 
 func (a *App) GetImageFromFolder(path string) (string, error) {
-	thumbnailDir := filepath.Join(xdg.CacheHome, "PhotoImporter", "thumbnails")
+	thumbnailDir := thumbnailCacheDir()
 
 	// Check that the path begins with the thumbnail directory
 	if !strings.HasPrefix(path, thumbnailDir) {
@@ -486,17 +909,87 @@ func (a *App) GetConfig() *Config {
 	return &configState
 }
 
-func (a *App) ClearCache() error {
-	thumbnailDir := xdg.CacheHome
-	thumbnailDir = filepath.Join(thumbnailDir, "PhotoImporter", "thumbnails")
+// updateConfig merges values into the stored config, keeping any keys that
+// are not set in values
+func (a *App) updateConfig(values map[string]interface{}) error {
+	data, err := a.configStore.Get(CONFIG_STORE_FILENAME, "{}")
+	if err != nil {
+		return fmt.Errorf("could not read the config file: %v", err)
+	}
 
-	rt.LogDebugf(a.ctx, "Clear cache: %s", thumbnailDir)
+	configState := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &configState); err != nil {
+		return fmt.Errorf("could not parse config data: %v", err)
+	}
 
-	err := os.RemoveAll(thumbnailDir)
+	for key, value := range values {
+		configState[key] = value
+	}
+
+	newData, err := json.MarshalIndent(configState, "", "  ")
 	if err != nil {
-		rt.LogDebugf(a.ctx, "Clear cache error: %v", err)
+		return fmt.Errorf("could not encode config data: %v", err)
+	}
+
+	return a.configStore.Set(CONFIG_STORE_FILENAME, wailsconfigstore.Config(newData))
+}
+
+func (a *App) ClearCache() error {
+	for _, dir := range []string{thumbnailCacheDir(), previewCacheDir(), cameraStagingDir()} {
+		rt.LogDebugf(a.ctx, "Clear cache: %s", dir)
+
+		err := os.RemoveAll(dir)
+		if err != nil {
+			rt.LogDebugf(a.ctx, "Clear cache error: %v", err)
+			return err
+		}
+	}
+
+	a.cache.reset()
+	return a.cache.save()
+}
+
+// ClearCacheForSource removes the cached images generated while browsing
+// source, for example a card that will not be imported again
+func (a *App) ClearCacheForSource(source string) error {
+	removed := a.cache.removeWhere(func(entry *CacheEntry) bool {
+		return entry.Source == source
+	})
+
+	rt.LogDebugf(a.ctx, "Cleared %d cached files for %s", removed, source)
+	return a.cache.save()
+}
+
+// ClearCacheOlderThan removes the cached images not used in the last days
+func (a *App) ClearCacheOlderThan(days int) error {
+	if days < 0 {
+		return fmt.Errorf("invalid number of days: %d", days)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	removed := a.cache.removeWhere(func(entry *CacheEntry) bool {
+		return entry.LastAccess.Before(cutoff)
+	})
+
+	rt.LogDebugf(a.ctx, "Cleared %d cached files not used since %s", removed, cutoff.Format(time.DateOnly))
+	return a.cache.save()
+}
+
+func (a *App) GetCacheStats() CacheStats {
+	return a.cache.stats()
+}
+
+// SetCacheMaxSize saves the cache size limit, in MB, evicting the least
+// recently used files if the cache is now too large
+func (a *App) SetCacheMaxSize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid cache size: %d MB", size)
+	}
+
+	if err := a.updateConfig(map[string]interface{}{"cacheMaxSize": size}); err != nil {
 		return err
 	}
 
-	return nil
+	a.cache.setMaxBytes(int64(size) * 1024 * 1024)
+	return a.cache.save()
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/adrg/xdg"
+)
+
+// Cached images are named after the quick identity of their original
+var cachedImageRegexp = regexp.MustCompile(`^([0-9a-f]{16})\.jpg$`)
+
+// Requested names of cached images, a hash and an extension
+var cachedImageNameRegexp = regexp.MustCompile(`^([0-9a-f]{16})(\.[a-z]+)$`)
+
+func previewCacheDir() string {
+	return filepath.Join(xdg.CacheHome, "PhotoImporter", "previews")
+}
+
+func thumbnailURL(hash string) string {
+	return "/thumbs/" + hash + ".jpg"
+}
+
+func previewURL(hash string) string {
+	return "/preview/" + hash + ".jpg"
+}
+
+// newAssetHandler serves cached thumbnails and previews to the frontend for
+// requests the embedded assets cannot answer
+func newAssetHandler(cache *cacheIndex) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /thumbs/{name}", cachedImageHandler(cache, CacheKindThumbnail, ".jpg", ".jpg"))
+	mux.Handle("GET /preview/{name}", cachedImageHandler(cache, CacheKindPreview, ".jpg", ".jpg"))
+	mux.Handle("GET /tile/{name}", tileHandler(cache))
+	mux.Handle("GET /overlay/{name}", cachedImageHandler(cache, CacheKindThumbnail, ".png", clippingOverlaySuffix))
+
+	return mux
+}
+
+// cachedImageHandler serves {hash}{ext} from the file {hash}{suffix} of a
+// cache directory. Only names that are exactly a hash are looked up, so no
+// other file can be reached. Serving a file counts as a use for the cache
+// eviction.
+func cachedImageHandler(cache *cacheIndex, kind string, ext string, suffix string) http.Handler {
+	contentType := mime.TypeByExtension(ext)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matches := cachedImageNameRegexp.FindStringSubmatch(r.PathValue("name"))
+		if matches == nil || matches[2] != ext {
+			http.NotFound(w, r)
+			return
+		}
+		hash := matches[1]
+
+		file, err := os.Open(filepath.Join(cacheKindDir(kind), hash+suffix))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			http.NotFound(w, r)
+			return
+		}
+
+		cache.touch(kind, hash+suffix)
+
+		// The content for a hash never changes
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("ETag", `"`+hash+`"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		http.ServeContent(w, r, "", info.ModTime(), file)
+	})
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	CacheKindThumbnail = "thumbnail"
+	CacheKindPreview   = "preview"
+)
+
+// Cached files start with the hash of their original, followed by what they
+// hold, for example .jpg for a thumbnail or .analysis.json for its analysis
+var cachedFileRegexp = regexp.MustCompile(`^([0-9a-f]{16})\.`)
+
+// defaultCacheMaxSize is used when the config does not set cacheMaxSize, in MB
+const defaultCacheMaxSize = 1024
+
+type CacheEntry struct {
+	Hash       string    `json:"hash"`
+	Kind       string    `json:"kind"`
+	File       string    `json:"file"`
+	Source     string    `json:"source"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	LastAccess time.Time `json:"last_access"`
+	// Orientation of the original of a thumbnail, which is stored upright,
+	// so a cached thumbnail is served without reading the original. Zero
+	// when not known.
+	Orientation int `json:"orientation,omitempty"`
+}
+
+type CacheStats struct {
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	MaxBytes int64   `json:"max_bytes"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+}
+
+type cacheIndexFile struct {
+	Entries []*CacheEntry `json:"entries"`
+	Hits    int64         `json:"hits"`
+	Misses  int64         `json:"misses"`
+}
+
+// cacheIndex tracks the files in the thumbnail and preview caches so the
+// least recently used ones can be evicted when the cache grows too large
+type cacheIndex struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	path     string
+	entries  map[string]*CacheEntry // keyed by kind and file name
+	bytes    int64
+	maxBytes int64
+	hits     int64
+	misses   int64
+	dirty    bool
+}
+
+func cacheRootDir() string {
+	return filepath.Join(xdg.CacheHome, "PhotoImporter")
+}
+
+func cacheKindDir(kind string) string {
+	if kind == CacheKindPreview {
+		return previewCacheDir()
+	}
+	return thumbnailCacheDir()
+}
+
+func cacheKey(kind string, file string) string {
+	return kind + "/" + file
+}
+
+func (e *CacheEntry) path() string {
+	return filepath.Join(cacheKindDir(e.Kind), e.File)
+}
+
+// newCacheIndex returns an empty index, which is loaded once the app starts
+func newCacheIndex() *cacheIndex {
+	return &cacheIndex{
+		path:     filepath.Join(cacheRootDir(), "cache-index.json"),
+		entries:  map[string]*CacheEntry{},
+		maxBytes: defaultCacheMaxSize * 1024 * 1024,
+	}
+}
+
+// load reads the index and reconciles it with the cache directories,
+// dropping entries whose file is gone and adding files that are not indexed
+func (c *cacheIndex) load(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ctx = ctx
+
+	var stored cacheIndexFile
+	if data, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			rt.LogWarningf(ctx, "could not parse the cache index: %v", err)
+		}
+	}
+
+	c.hits = stored.Hits
+	c.misses = stored.Misses
+
+	for _, entry := range stored.Entries {
+		info, err := os.Stat(entry.path())
+		if err != nil {
+			c.dirty = true
+			continue
+		}
+
+		entry.Size = info.Size()
+		c.entries[cacheKey(entry.Kind, entry.File)] = entry
+		c.bytes += entry.Size
+	}
+
+	for _, kind := range []string{CacheKindThumbnail, CacheKindPreview} {
+		files, err := os.ReadDir(cacheKindDir(kind))
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() || c.entries[cacheKey(kind, file.Name())] != nil {
+				continue
+			}
+
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+
+			matches := cachedFileRegexp.FindStringSubmatch(file.Name())
+			hash := ""
+			if matches != nil {
+				hash = matches[1]
+			}
+
+			c.entries[cacheKey(kind, file.Name())] = &CacheEntry{
+				Hash:       hash,
+				Kind:       kind,
+				File:       file.Name(),
+				Size:       info.Size(),
+				Created:    info.ModTime(),
+				LastAccess: info.ModTime(),
+			}
+			c.bytes += info.Size()
+			c.dirty = true
+		}
+	}
+}
+
+func (c *cacheIndex) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	stored := cacheIndexFile{Hits: c.hits, Misses: c.misses}
+	for _, entry := range c.entries {
+		stored.Entries = append(stored.Entries, entry)
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(c.path, data, 0644); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// lookup records a cache lookup for a file, counting it as a hit or a miss
+func (c *cacheIndex) lookup(kind string, file string, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if found {
+		c.hits++
+		if entry := c.entries[cacheKey(kind, file)]; entry != nil {
+			entry.LastAccess = time.Now()
+		}
+	} else {
+		c.misses++
+	}
+	c.dirty = true
+}
+
+// touch marks a file as used without counting a lookup
+func (c *cacheIndex) touch(kind string, file string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entries[cacheKey(kind, file)]; entry != nil {
+		entry.LastAccess = time.Now()
+		c.dirty = true
+	}
+}
+
+// orientation returns the orientation recorded for the original of a cached
+// file, or zero
+func (c *cacheIndex) orientation(kind string, file string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entries[cacheKey(kind, file)]; entry != nil {
+		return entry.Orientation
+	}
+	return 0
+}
+
+// setOrientation records the orientation of the original of a cached file
+func (c *cacheIndex) setOrientation(kind string, file string, orientation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry := c.entries[cacheKey(kind, file)]; entry != nil && entry.Orientation != orientation {
+		entry.Orientation = orientation
+		c.dirty = true
+	}
+}
+
+// add indexes a file written to the cache and evicts the least recently used
+// files if the cache is now over its size limit
+func (c *cacheIndex) add(kind string, hash string, file string, source string) {
+	info, err := os.Stat(filepath.Join(cacheKindDir(kind), file))
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(kind, file)
+	if previous := c.entries[key]; previous != nil {
+		c.bytes -= previous.Size
+	}
+
+	now := time.Now()
+	c.entries[key] = &CacheEntry{
+		Hash:       hash,
+		Kind:       kind,
+		File:       file,
+		Source:     source,
+		Size:       info.Size(),
+		Created:    now,
+		LastAccess: now,
+	}
+	c.bytes += info.Size()
+	c.dirty = true
+
+	if c.bytes > c.maxBytes {
+		c.evictLocked(c.maxBytes)
+	}
+}
+
+func (c *cacheIndex) setMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxBytes = maxBytes
+	if c.bytes > c.maxBytes {
+		c.evictLocked(c.maxBytes)
+	}
+}
+
+// evictLocked removes the least recently used files until the cache is no
+// larger than maxBytes. The files made from the same original, such as a
+// thumbnail and its analysis, are removed together so none is left behind,
+// and are as recent as the last one used.
+func (c *cacheIndex) evictLocked(maxBytes int64) {
+	groups := map[string][]*CacheEntry{}
+	lastAccess := map[string]time.Time{}
+	for key, entry := range c.entries {
+		group := entry.Hash
+		if group == "" {
+			group = key
+		}
+
+		groups[group] = append(groups[group], entry)
+		if entry.LastAccess.After(lastAccess[group]) {
+			lastAccess[group] = entry.LastAccess
+		}
+	}
+
+	order := make([]string, 0, len(groups))
+	for group := range groups {
+		order = append(order, group)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return lastAccess[order[i]].Before(lastAccess[order[j]])
+	})
+
+	for _, group := range order {
+		if c.bytes <= maxBytes {
+			break
+		}
+		for _, entry := range groups[group] {
+			c.removeLocked(entry)
+		}
+	}
+}
+
+func (c *cacheIndex) removeLocked(entry *CacheEntry) {
+	if err := os.Remove(entry.path()); err != nil && !os.IsNotExist(err) {
+		rt.LogWarningf(c.ctx, "could not remove cached file %s: %v", entry.path(), err)
+		return
+	}
+
+	if entry.Kind == CacheKindPreview {
+		decodedPreviews.forget(entry.Hash)
+	}
+
+	delete(c.entries, cacheKey(entry.Kind, entry.File))
+	c.bytes -= entry.Size
+	c.dirty = true
+}
+
+// removeWhere removes every cached file for which match returns true
+func (c *cacheIndex) removeWhere(match func(entry *CacheEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, entry := range c.entries {
+		if match(entry) {
+			c.removeLocked(entry)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// reset forgets every entry and the hit statistics, after the cache
+// directories have been removed
+func (c *cacheIndex) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.entries {
+		if entry.Kind == CacheKindPreview {
+			decodedPreviews.forget(entry.Hash)
+		}
+	}
+
+	c.entries = map[string]*CacheEntry{}
+	c.bytes = 0
+	c.hits = 0
+	c.misses = 0
+	c.dirty = true
+}
+
+func (c *cacheIndex) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Entries:  len(c.entries),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRate = float64(c.hits) / float64(lookups)
+	}
+
+	return stats
+}
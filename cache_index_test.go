@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+func TestCacheIndexEviction(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []int64
+		// touched files are used after all were added
+		touched  []int
+		maxBytes int64
+		want     []int
+	}{
+		{
+			name:     "under the limit",
+			sizes:    []int64{100, 100, 100},
+			maxBytes: 300,
+			want:     []int{0, 1, 2},
+		},
+		{
+			name:     "least recently used first",
+			sizes:    []int64{100, 100, 100},
+			maxBytes: 200,
+			want:     []int{1, 2},
+		},
+		{
+			name:     "until it fits",
+			sizes:    []int64{100, 100, 100, 100},
+			maxBytes: 150,
+			want:     []int{3},
+		},
+		{
+			name:     "used files are kept",
+			sizes:    []int64{100, 100, 100},
+			touched:  []int{0},
+			maxBytes: 200,
+			want:     []int{0, 2},
+		},
+		{
+			name:     "a large file evicts several",
+			sizes:    []int64{100, 100, 100, 250},
+			maxBytes: 300,
+			want:     []int{3},
+		},
+		{
+			name:     "no limit left",
+			sizes:    []int64{100, 100},
+			maxBytes: 0,
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheHome := xdg.CacheHome
+			xdg.CacheHome = t.TempDir()
+			defer func() { xdg.CacheHome = cacheHome }()
+
+			dir := thumbnailCacheDir()
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &cacheIndex{entries: map[string]*CacheEntry{}, maxBytes: 1 << 30}
+
+			// Files are used one after another, an hour ago
+			used := time.Now().Add(-time.Hour)
+			names := make([]string, len(tt.sizes))
+			for i, size := range tt.sizes {
+				hash := "000000000000000" + string(rune('a'+i))
+				names[i] = hash + ".jpg"
+				if err := os.WriteFile(filepath.Join(dir, names[i]), make([]byte, size), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				c.add(CacheKindThumbnail, hash, names[i], "/media/card")
+				c.entries[cacheKey(CacheKindThumbnail, names[i])].LastAccess = used.Add(time.Duration(i) * time.Second)
+			}
+			for _, i := range tt.touched {
+				c.touch(CacheKindThumbnail, names[i])
+			}
+
+			c.setMaxBytes(tt.maxBytes)
+
+			var kept []int
+			var bytes int64
+			for i, name := range names {
+				_, indexed := c.entries[cacheKey(CacheKindThumbnail, name)]
+				_, err := os.Stat(filepath.Join(dir, name))
+				if indexed != (err == nil) {
+					t.Errorf("%s indexed = %v but stat = %v", name, indexed, err)
+				}
+				if indexed {
+					kept = append(kept, i)
+					bytes += tt.sizes[i]
+				}
+			}
+
+			if len(kept) != len(tt.want) {
+				t.Fatalf("kept files %v, want %v", kept, tt.want)
+			}
+			for i := range kept {
+				if kept[i] != tt.want[i] {
+					t.Fatalf("kept files %v, want %v", kept, tt.want)
+				}
+			}
+			if c.bytes != bytes || c.bytes > tt.maxBytes {
+				t.Errorf("index holds %d bytes, files hold %d, limit %d", c.bytes, bytes, tt.maxBytes)
+			}
+		})
+	}
+}
+
+func TestCacheIndexEvictsSidecarsWithTheirThumbnail(t *testing.T) {
+	tests := []struct {
+		name string
+		// touched sidecars are used after all files were added
+		touched  []int
+		maxBytes int64
+		want     []int
+	}{
+		{
+			name:     "sidecars go with their thumbnail",
+			maxBytes: 250,
+			want:     []int{1, 2},
+		},
+		{
+			name:     "a used sidecar keeps its thumbnail",
+			touched:  []int{0},
+			maxBytes: 250,
+			want:     []int{0, 2},
+		},
+	}
+
+	sidecars := []string{analysisSuffix, clippingOverlaySuffix, dHashSuffix, sharpnessSuffix}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheHome := xdg.CacheHome
+			xdg.CacheHome = t.TempDir()
+			defer func() { xdg.CacheHome = cacheHome }()
+
+			dir := thumbnailCacheDir()
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &cacheIndex{entries: map[string]*CacheEntry{}, maxBytes: 1 << 30}
+
+			// Each original has a 100 byte thumbnail and four 5 byte
+			// sidecars, used one original after another an hour ago
+			used := time.Now().Add(-time.Hour)
+			hashes := make([]string, 3)
+			for i := range hashes {
+				hashes[i] = "000000000000000" + string(rune('a'+i))
+				files := map[string]int64{hashes[i] + ".jpg": 100}
+				for _, suffix := range sidecars {
+					files[hashes[i]+suffix] = 5
+				}
+
+				for name, size := range files {
+					if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+						t.Fatal(err)
+					}
+					c.add(CacheKindThumbnail, hashes[i], name, "/media/card")
+					c.entries[cacheKey(CacheKindThumbnail, name)].LastAccess = used.Add(time.Duration(i) * time.Second)
+				}
+			}
+			for _, i := range tt.touched {
+				c.touch(CacheKindThumbnail, hashes[i]+dHashSuffix)
+			}
+
+			c.setMaxBytes(tt.maxBytes)
+
+			var kept []int
+			for i, hash := range hashes {
+				names := []string{hash + ".jpg"}
+				for _, suffix := range sidecars {
+					names = append(names, hash+suffix)
+				}
+
+				indexed := 0
+				for _, name := range names {
+					_, ok := c.entries[cacheKey(CacheKindThumbnail, name)]
+					if _, err := os.Stat(filepath.Join(dir, name)); ok != (err == nil) {
+						t.Errorf("%s indexed = %v but stat = %v", name, ok, err)
+					}
+					if ok {
+						indexed++
+					}
+				}
+
+				switch indexed {
+				case len(names):
+					kept = append(kept, i)
+				case 0:
+				default:
+					t.Errorf("%d of the %d files of %s were kept", indexed, len(names), hash)
+				}
+			}
+
+			if fmt.Sprint(kept) != fmt.Sprint(tt.want) {
+				t.Errorf("kept originals %v, want %v", kept, tt.want)
+			}
+		})
+	}
+}
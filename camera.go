@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/cespare/xxhash"
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Files on cameras are addressed as camera://<backend>/<port>/<folder>/<name>,
+// with the port escaped, and the camera itself as camera://<backend>/<port>
+const cameraScheme = "camera://"
+
+// CameraDevice is a camera connected over USB
+type CameraDevice struct {
+	Model  string
+	Port   string
+	Serial string
+}
+
+// CameraFile is a file in the storage of a camera. Folder is absolute in the
+// camera, e.g. /store_00010001/DCIM/100CANON.
+type CameraFile struct {
+	Folder   string
+	Name     string
+	Size     int64
+	ModTime  time.Time
+	MimeType string
+}
+
+// CameraBackend talks to cameras with one protocol or tool
+type CameraBackend interface {
+	Name() string
+	Detect(ctx context.Context) ([]CameraDevice, error)
+	List(ctx context.Context, port string) ([]CameraFile, error)
+	// Stat fills in the size and time of a file given by folder and name
+	Stat(ctx context.Context, port string, file CameraFile) (CameraFile, error)
+	Download(ctx context.Context, port string, file CameraFile, dst string) error
+	Delete(ctx context.Context, port string, file CameraFile) error
+}
+
+// cameraMu serialises access to cameras, which only handle one operation at
+// a time
+var cameraMu sync.Mutex
+
+// cameraBackends returns the backends that can be used: gphoto2 when it is
+// installed, and the fake camera when PHOTO_IMPORTER_FAKE_CAMERA names a
+// folder to serve
+func cameraBackends() []CameraBackend {
+	var backends []CameraBackend
+	if backend, ok := newGphoto2Backend(); ok {
+		backends = append(backends, backend)
+	}
+	if dir := os.Getenv("PHOTO_IMPORTER_FAKE_CAMERA"); dir != "" {
+		backends = append(backends, &fakeCameraBackend{dir: dir})
+	}
+	return backends
+}
+
+func cameraBackendNamed(name string) (CameraBackend, error) {
+	for _, backend := range cameraBackends() {
+		if backend.Name() == name {
+			return backend, nil
+		}
+	}
+	return nil, fmt.Errorf("camera backend %s is not available", name)
+}
+
+func isCameraPath(p string) bool {
+	return strings.HasPrefix(p, cameraScheme)
+}
+
+func cameraSource(backend string, port string) string {
+	return cameraScheme + backend + "/" + url.PathEscape(port)
+}
+
+func cameraFilePath(backend string, port string, file CameraFile) string {
+	return cameraSource(backend, port) + path.Join(file.Folder, file.Name)
+}
+
+// parseCameraPath splits a camera:// path into its backend, port and the
+// path in the camera, which is "/" for the camera itself
+func parseCameraPath(p string) (backend string, port string, inCamera string, err error) {
+	rest, ok := strings.CutPrefix(p, cameraScheme)
+	if !ok {
+		return "", "", "", fmt.Errorf("%s is not a camera path", p)
+	}
+
+	backend, rest, _ = strings.Cut(rest, "/")
+	escapedPort, inCamera, _ := strings.Cut(rest, "/")
+	port, err = url.PathUnescape(escapedPort)
+	if err != nil || backend == "" || port == "" {
+		return "", "", "", fmt.Errorf("invalid camera path %s", p)
+	}
+
+	return backend, port, path.Clean("/" + inCamera), nil
+}
+
+// cameraDetection keeps the cameras last detected, as detecting runs gphoto2
+// and sources are listed often. The disk watcher forgets them each time it
+// looks for changes.
+type cameraDetection struct {
+	mu    sync.Mutex
+	disks []DiskInfo
+	valid bool
+}
+
+// cameraDisks lists the connected cameras as sources
+func (a *App) cameraDisks() []DiskInfo {
+	a.cameras.mu.Lock()
+	defer a.cameras.mu.Unlock()
+
+	if !a.cameras.valid {
+		a.cameras.disks, a.cameras.valid = a.detectCameras()
+	}
+
+	return append([]DiskInfo(nil), a.cameras.disks...)
+}
+
+// forgetCameraDisks makes the next listing detect the cameras again
+func (a *App) forgetCameraDisks() {
+	a.cameras.mu.Lock()
+	a.cameras.valid = false
+	a.cameras.mu.Unlock()
+}
+
+// detectCameras asks every backend for its cameras. The result is only
+// complete when no backend failed.
+func (a *App) detectCameras() ([]DiskInfo, bool) {
+	cameraMu.Lock()
+	defer cameraMu.Unlock()
+
+	var disks []DiskInfo
+	complete := true
+	for _, backend := range cameraBackends() {
+		devices, err := backend.Detect(a.ctx)
+		if err != nil {
+			rt.LogWarningf(a.ctx, "failed to detect cameras with %s: %v", backend.Name(), err)
+			complete = false
+			continue
+		}
+
+		for _, device := range devices {
+			disks = append(disks, cameraDisk(backend.Name(), device))
+		}
+	}
+
+	return disks, complete
+}
+
+func cameraDisk(backend string, device CameraDevice) DiskInfo {
+	cameraMake, _, _ := strings.Cut(device.Model, " ")
+
+	// Ports change each time a camera is plugged in, serials do not
+	identity := device.Serial
+	if identity == "" {
+		identity = device.Port
+	}
+
+	return DiskInfo{
+		Label:      device.Model,
+		Model:      device.Model,
+		MountPoint: cameraSource(backend, device.Port),
+		Device:     device.Port,
+		Drive:      device.Port,
+		UUID:       device.Serial,
+		HasDCIM:    true,
+		CameraMake: cameraMake,
+		ID:         fmt.Sprintf("%016x", xxhash.Sum64String("camera\x00"+backend+"\x00"+device.Model+"\x00"+identity)),
+		Camera:     true,
+	}
+}
+
+// listCameraFiles lists the raw files on the camera at source
+func (a *App) listCameraFiles(source string) ([]FileInfo, error) {
+	backendName, port, _, err := parseCameraPath(source)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := cameraBackendNamed(backendName)
+	if err != nil {
+		return nil, err
+	}
+
+	cameraMu.Lock()
+	cameraFiles, err := backend.List(a.ctx, port)
+	cameraMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files on the camera: %v", err)
+	}
+
+	var files []FileInfo
+	for _, file := range cameraFiles {
+		if strings.HasPrefix(file.Name, ".") || !isAllowedExtension(file.Name) {
+			continue
+		}
+
+		files = append(files, FileInfo{
+			Path:     cameraFilePath(backendName, port, file),
+			IsFile:   true,
+			Size:     file.Size,
+			MimeType: file.MimeType,
+			Filename: file.Name,
+		})
+	}
+
+	rt.LogInfof(a.ctx, "Total files found on the camera: %d", len(files))
+
+	return files, nil
+}
+
+// cameraStagingMaxAge is how long downloaded copies left behind by browsing
+// a camera are kept
+const cameraStagingMaxAge = 24 * time.Hour
+
+func cameraStagingDir() string {
+	return filepath.Join(xdg.CacheHome, "PhotoImporter", "camera")
+}
+
+// stagedCameraPath is where a camera file is downloaded to. Names repeat once
+// a card is formatted and ports are reused, so the copy is kept per size and
+// time as well as path. It keeps the name of the file, which the import and
+// DNG conversion use.
+func stagedCameraPath(p string, file CameraFile) string {
+	version := fmt.Sprintf("%d\x00%d", file.Size, file.ModTime.Unix())
+	return filepath.Join(stagedCameraDir(p), fmt.Sprintf("%016x", xxhash.Sum64String(version)), path.Base(p))
+}
+
+// stagedCameraDir holds every downloaded version of a camera file
+func stagedCameraDir(p string) string {
+	return filepath.Join(cameraStagingDir(), fmt.Sprintf("%016x", xxhash.Sum64String(p)))
+}
+
+// stagingLocks serialise staging and removing the copies of each camera
+// file, so one caller does not remove a download another is writing
+var (
+	stagingLocksMu sync.Mutex
+	stagingLocks   = map[string]*stagingLock{}
+)
+
+type stagingLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockStagedCameraFile locks the staging folder of a camera file until the
+// returned function is called
+func lockStagedCameraFile(p string) func() {
+	stagingLocksMu.Lock()
+	lock, ok := stagingLocks[p]
+	if !ok {
+		lock = &stagingLock{}
+		stagingLocks[p] = lock
+	}
+	lock.users++
+	stagingLocksMu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		stagingLocksMu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(stagingLocks, p)
+		}
+		stagingLocksMu.Unlock()
+	}
+}
+
+// statCameraFile finds the backend, port and details of a camera file
+func statCameraFile(ctx context.Context, p string) (CameraBackend, string, CameraFile, error) {
+	backendName, port, inCamera, err := parseCameraPath(p)
+	if err != nil {
+		return nil, "", CameraFile{}, err
+	}
+	backend, err := cameraBackendNamed(backendName)
+	if err != nil {
+		return nil, "", CameraFile{}, err
+	}
+
+	cameraMu.Lock()
+	file, err := backend.Stat(ctx, port, CameraFile{Folder: path.Dir(inCamera), Name: path.Base(inCamera)})
+	cameraMu.Unlock()
+	if err != nil {
+		return nil, "", CameraFile{}, err
+	}
+
+	return backend, port, file, nil
+}
+
+// stageCameraFile downloads a camera file to the staging folder, where the
+// rest of the pipeline reads it like any other file, and returns its path
+func stageCameraFile(ctx context.Context, p string) (string, error) {
+	backend, port, file, err := statCameraFile(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := lockStagedCameraFile(p)
+	defer unlock()
+
+	staged := stagedCameraPath(p, file)
+	if _, err := os.Stat(staged); err == nil {
+		return staged, nil
+	}
+
+	// Older versions of the file are of no use any more
+	os.RemoveAll(stagedCameraDir(p))
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %v", err)
+	}
+
+	partial := staged + ".partial"
+
+	cameraMu.Lock()
+	err = backend.Download(ctx, port, file, partial)
+	cameraMu.Unlock()
+	if err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("failed to download %s from the camera: %v", file.Name, err)
+	}
+
+	if err := os.Rename(partial, staged); err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("failed to stage %s: %v", file.Name, err)
+	}
+
+	return staged, nil
+}
+
+// unstageCameraFile removes the downloaded copies of a camera file
+func unstageCameraFile(p string) {
+	unlock := lockStagedCameraFile(p)
+	defer unlock()
+
+	os.RemoveAll(stagedCameraDir(p))
+}
+
+// pruneCameraStaging removes the copies downloaded for browsing that have not
+// been used for cameraStagingMaxAge
+func (a *App) pruneCameraStaging() {
+	entries, err := os.ReadDir(cameraStagingDir())
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < cameraStagingMaxAge {
+			continue
+		}
+
+		rt.LogDebugf(a.ctx, "Removing stale camera download %s", entry.Name())
+		os.RemoveAll(filepath.Join(cameraStagingDir(), entry.Name()))
+	}
+}
+
+// deleteCameraFile deletes a file from the camera and its staged copy
+func deleteCameraFile(ctx context.Context, p string) error {
+	backend, port, file, err := statCameraFile(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	cameraMu.Lock()
+	err = backend.Delete(ctx, port, file)
+	cameraMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	unstageCameraFile(p)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wailsapp/mimetype"
+)
+
+// fakeCameraBackend presents a folder as a connected camera, to try the
+// camera pipeline without one
+type fakeCameraBackend struct {
+	dir string
+}
+
+func (f *fakeCameraBackend) Name() string {
+	return "fake"
+}
+
+func (f *fakeCameraBackend) Detect(ctx context.Context) ([]CameraDevice, error) {
+	if info, err := os.Stat(f.dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	return []CameraDevice{{Model: "Fake Camera", Port: "fake:0", Serial: "FAKE0001"}}, nil
+}
+
+// local maps a file of the camera to the folder
+func (f *fakeCameraBackend) local(file CameraFile) (string, error) {
+	p := path.Join(file.Folder, file.Name)
+	if strings.Contains(p, "..") {
+		return "", fmt.Errorf("invalid camera path %s", p)
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(p)), nil
+}
+
+func (f *fakeCameraBackend) List(ctx context.Context, port string) ([]CameraFile, error) {
+	var files []CameraFile
+	err := filepath.WalkDir(f.dir, func(p string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(f.dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+
+		var mimeType string
+		if mime, err := mimetype.DetectFile(p); err == nil {
+			mimeType = mime.String()
+		}
+
+		files = append(files, CameraFile{
+			Folder:   path.Clean("/" + filepath.ToSlash(rel)),
+			Name:     entry.Name(),
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			MimeType: mimeType,
+		})
+		return nil
+	})
+
+	return files, err
+}
+
+func (f *fakeCameraBackend) Stat(ctx context.Context, port string, file CameraFile) (CameraFile, error) {
+	local, err := f.local(file)
+	if err != nil {
+		return CameraFile{}, err
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return CameraFile{}, err
+	}
+
+	file.Size = info.Size()
+	file.ModTime = info.ModTime()
+	return file, nil
+}
+
+func (f *fakeCameraBackend) Download(ctx context.Context, port string, file CameraFile, dst string) error {
+	src, err := f.local(file)
+	if err != nil {
+		return err
+	}
+	return copyFile(src, dst)
+}
+
+func (f *fakeCameraBackend) Delete(ctx context.Context, port string, file CameraFile) error {
+	src, err := f.local(file)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
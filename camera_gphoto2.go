@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// There are 3 files in folder '/store_00010001/DCIM/100CANON':
+	gphoto2FolderRegexp = regexp.MustCompile(`^There (?:is|are) \d+ files? in folder '(.*)':$`)
+	// #1     IMG_0001.CR3               rd 25312 KB 6720x4480 image/x-canon-cr3 1699999999
+	// with the dimensions and the time only when the camera reports them
+	gphoto2FileRegexp = regexp.MustCompile(`^#\d+\s+(\S+)\s+(?:rd\s+)?(\d+) KB(?:\s+\d+x\d+)?\s+(\S+)(?:\s+(\d+))?`)
+)
+
+// gphoto2Backend runs the gphoto2 command line tool, which reaches most
+// cameras over PTP. gphoto2 addresses files by their number in a folder, so
+// the last listing of each camera is kept to find them.
+type gphoto2Backend struct {
+	path     string
+	listings map[string][]CameraFile
+}
+
+var (
+	gphoto2 = &gphoto2Backend{listings: map[string][]CameraFile{}}
+	// gphoto2 is looked up once, as backends are created from several
+	// goroutines
+	gphoto2Once sync.Once
+)
+
+func newGphoto2Backend() (*gphoto2Backend, bool) {
+	gphoto2Once.Do(func() {
+		if p, err := exec.LookPath("gphoto2"); err == nil {
+			gphoto2.path = p
+		}
+	})
+	return gphoto2, gphoto2.path != ""
+}
+
+func (g *gphoto2Backend) Name() string {
+	return "gphoto2"
+}
+
+func (g *gphoto2Backend) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, g.path, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("%s failed: %v: %s", cmd.String(), err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+func (g *gphoto2Backend) Detect(ctx context.Context) ([]CameraDevice, error) {
+	output, err := g.run(ctx, "--auto-detect")
+	if err != nil {
+		return nil, err
+	}
+
+	// A header and a rule, then the model and the port of each camera
+	var devices []CameraDevice
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line < 2 || len(fields) < 2 {
+			continue
+		}
+
+		port := fields[len(fields)-1]
+		if !strings.Contains(port, ":") {
+			continue
+		}
+
+		device := CameraDevice{
+			Model: strings.Join(fields[:len(fields)-1], " "),
+			Port:  port,
+		}
+		device.Serial = g.serial(ctx, port)
+		devices = append(devices, device)
+	}
+
+	return devices, scanner.Err()
+}
+
+// serial reads the serial number from the summary of a camera, if it has one
+func (g *gphoto2Backend) serial(ctx context.Context, port string) string {
+	output, err := g.run(ctx, "--port", port, "--summary")
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if serial, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "Serial Number:"); ok {
+			return strings.TrimSpace(serial)
+		}
+	}
+	return ""
+}
+
+// List lists the files of every folder. gphoto2 only reports sizes in KB, so
+// sizes are approximate.
+func (g *gphoto2Backend) List(ctx context.Context, port string) ([]CameraFile, error) {
+	output, err := g.run(ctx, "--port", port, "--list-files")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []CameraFile
+	folder := "/"
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if matches := gphoto2FolderRegexp.FindStringSubmatch(line); matches != nil {
+			folder = matches[1]
+			continue
+		}
+
+		matches := gphoto2FileRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		size, _ := strconv.ParseInt(matches[2], 10, 64)
+		file := CameraFile{
+			Folder:   folder,
+			Name:     matches[1],
+			Size:     size * 1024,
+			MimeType: matches[3],
+		}
+		if seconds, err := strconv.ParseInt(matches[4], 10, 64); err == nil {
+			file.ModTime = time.Unix(seconds, 0)
+		}
+		files = append(files, file)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	g.listings[port] = files
+	return files, nil
+}
+
+// find returns the listed file and its number in its folder, listing the
+// camera again when the file is not in the last listing
+func (g *gphoto2Backend) find(ctx context.Context, port string, file CameraFile) (CameraFile, int, error) {
+	find := func() (CameraFile, int) {
+		n := 0
+		for _, listed := range g.listings[port] {
+			if listed.Folder != file.Folder {
+				continue
+			}
+			n++
+			if listed.Name == file.Name {
+				return listed, n
+			}
+		}
+		return CameraFile{}, 0
+	}
+
+	if listed, n := find(); n > 0 {
+		return listed, n, nil
+	}
+	if _, err := g.List(ctx, port); err != nil {
+		return CameraFile{}, 0, err
+	}
+	if listed, n := find(); n > 0 {
+		return listed, n, nil
+	}
+
+	return CameraFile{}, 0, fmt.Errorf("%s is not on the camera", path.Join(file.Folder, file.Name))
+}
+
+func (g *gphoto2Backend) Stat(ctx context.Context, port string, file CameraFile) (CameraFile, error) {
+	listed, _, err := g.find(ctx, port, file)
+	return listed, err
+}
+
+func (g *gphoto2Backend) Download(ctx context.Context, port string, file CameraFile, dst string) error {
+	_, n, err := g.find(ctx, port, file)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.run(ctx, "--port", port, "--folder", file.Folder, "--get-file", strconv.Itoa(n), "--filename", dst, "--force-overwrite")
+	return err
+}
+
+func (g *gphoto2Backend) Delete(ctx context.Context, port string, file CameraFile) error {
+	_, n, err := g.find(ctx, port, file)
+	if err != nil {
+		return err
+	}
+
+	// The files after it are numbered one lower once it is gone
+	delete(g.listings, port)
+
+	_, err = g.run(ctx, "--port", port, "--folder", file.Folder, "--delete-file", strconv.Itoa(n))
+	return err
+}
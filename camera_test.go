@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+func TestCameraPathRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		port     string
+		file     CameraFile
+		inCamera string
+	}{
+		{
+			name:     "usb port",
+			backend:  "gphoto2",
+			port:     "usb:001,005",
+			file:     CameraFile{Folder: "/store_00010001/DCIM/100CANON", Name: "IMG_0001.CR3"},
+			inCamera: "/store_00010001/DCIM/100CANON/IMG_0001.CR3",
+		},
+		{
+			name:     "port with a slash",
+			backend:  "gphoto2",
+			port:     "ptpip:192.168.1.10/camera",
+			file:     CameraFile{Folder: "/DCIM/100MSDCF", Name: "DSC00001.ARW"},
+			inCamera: "/DCIM/100MSDCF/DSC00001.ARW",
+		},
+		{
+			name:     "file at the root",
+			backend:  "fake",
+			port:     "fake:0",
+			file:     CameraFile{Folder: "/", Name: "IMG_0001.DNG"},
+			inCamera: "/IMG_0001.DNG",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := cameraFilePath(tt.backend, tt.port, tt.file)
+			if !isCameraPath(p) {
+				t.Fatalf("%s is not a camera path", p)
+			}
+
+			backend, port, inCamera, err := parseCameraPath(p)
+			if err != nil {
+				t.Fatalf("parseCameraPath(%q): %v", p, err)
+			}
+			if backend != tt.backend || port != tt.port || inCamera != tt.inCamera {
+				t.Errorf("parseCameraPath(%q) = %q, %q, %q, want %q, %q, %q", p, backend, port, inCamera, tt.backend, tt.port, tt.inCamera)
+			}
+
+			_, _, root, err := parseCameraPath(cameraSource(tt.backend, tt.port))
+			if err != nil || root != "/" {
+				t.Errorf("parseCameraPath of the camera = %q, %v, want /", root, err)
+			}
+		})
+	}
+}
+
+func TestParseCameraPathInvalid(t *testing.T) {
+	for _, p := range []string{
+		"/media/card/DCIM/IMG_0001.CR3",
+		"camera://",
+		"camera://gphoto2",
+		"camera:///usb:001,005/DCIM",
+		"camera://gphoto2/%zz/DCIM",
+	} {
+		if _, _, _, err := parseCameraPath(p); err == nil {
+			t.Errorf("parseCameraPath(%q) succeeded", p)
+		}
+	}
+}
+
+// useFakeCamera serves dir as the fake camera and stages its files in a
+// temporary cache
+func useFakeCamera(t *testing.T, dir string) {
+	t.Helper()
+
+	cacheHome := xdg.CacheHome
+	xdg.CacheHome = t.TempDir()
+	t.Cleanup(func() { xdg.CacheHome = cacheHome })
+
+	t.Setenv("PHOTO_IMPORTER_FAKE_CAMERA", dir)
+}
+
+func writeCameraFile(t *testing.T, path string, data string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeCameraListStageDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	useFakeCamera(t, dir)
+
+	shot := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first := filepath.Join(dir, "DCIM", "100TEST", "IMG_0001.DNG")
+	writeCameraFile(t, first, "first shot", shot)
+	writeCameraFile(t, filepath.Join(dir, "DCIM", "100TEST", "IMG_0002.DNG"), "second", shot)
+
+	backend := &fakeCameraBackend{dir: dir}
+	listed, err := backend.List(ctx, "fake:0")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listed) != 2 {
+		t.Fatalf("List returned %d files, want 2", len(listed))
+	}
+
+	file := listed[0]
+	if file.Folder != "/DCIM/100TEST" || file.Name != "IMG_0001.DNG" || file.Size != int64(len("first shot")) || !file.ModTime.Equal(shot) {
+		t.Errorf("List returned %+v", file)
+	}
+
+	p := cameraFilePath("fake", "fake:0", file)
+	staged, err := stageCameraFile(ctx, p)
+	if err != nil {
+		t.Fatalf("stageCameraFile: %v", err)
+	}
+	if want := stagedCameraPath(p, file); staged != want {
+		t.Errorf("staged at %s, want %s", staged, want)
+	}
+	if data, err := os.ReadFile(staged); err != nil || string(data) != "first shot" {
+		t.Errorf("staged copy holds %q, %v", data, err)
+	}
+
+	// A file of the same size and time is not downloaded again
+	writeCameraFile(t, first, "other shot", shot)
+	if again, err := stageCameraFile(ctx, p); err != nil || again != staged {
+		t.Errorf("staging again = %s, %v, want %s", again, err, staged)
+	}
+	if data, _ := os.ReadFile(staged); string(data) != "first shot" {
+		t.Errorf("staged copy was downloaded again")
+	}
+
+	// A file that changed replaces the old copy
+	writeCameraFile(t, first, "a new shot", shot.Add(time.Minute))
+	replaced, err := stageCameraFile(ctx, p)
+	if err != nil {
+		t.Fatalf("stageCameraFile: %v", err)
+	}
+	if replaced == staged {
+		t.Errorf("changed file was staged at the same path %s", staged)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("old copy %s was kept", staged)
+	}
+	if data, _ := os.ReadFile(replaced); string(data) != "a new shot" {
+		t.Errorf("staged copy holds %q", data)
+	}
+
+	if err := deleteCameraFile(ctx, p); err != nil {
+		t.Fatalf("deleteCameraFile: %v", err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("file is still on the camera")
+	}
+	if _, err := os.Stat(stagedCameraDir(p)); !os.IsNotExist(err) {
+		t.Errorf("staged copies were kept after the delete")
+	}
+
+	listed, err = backend.List(ctx, "fake:0")
+	if err != nil || len(listed) != 1 || listed[0].Name != "IMG_0002.DNG" {
+		t.Errorf("List after the delete = %+v, %v", listed, err)
+	}
+}
+
+func TestStageCameraFileConcurrently(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	useFakeCamera(t, dir)
+
+	shot := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := strings.Repeat("raw data ", 1<<16)
+	writeCameraFile(t, filepath.Join(dir, "DCIM", "100TEST", "IMG_0001.DNG"), data, shot)
+	p := cameraFilePath("fake", "fake:0", CameraFile{Folder: "/DCIM/100TEST", Name: "IMG_0001.DNG"})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			staged, err := stageCameraFile(ctx, p)
+			if err != nil {
+				t.Errorf("stageCameraFile: %v", err)
+				return
+			}
+			if got, err := os.ReadFile(staged); err != nil || string(got) != data {
+				t.Errorf("staged copy holds %d bytes, %v, want %d", len(got), err, len(data))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFakeCameraRejectsPathsOutsideItsFolder(t *testing.T) {
+	backend := &fakeCameraBackend{dir: t.TempDir()}
+
+	_, err := backend.Stat(context.Background(), "fake:0", CameraFile{Folder: "/../..", Name: "passwd"})
+	if err == nil {
+		t.Errorf("Stat outside the folder succeeded")
+	}
+}
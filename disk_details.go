@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/cespare/xxhash"
+)
+
+// DCIM folder names are three digits followed by five characters chosen by
+// the camera maker, e.g. 100CANON or 101MSDCF
+var dcimFolderRegexp = regexp.MustCompile(`^[1-9]\d{2}([0-9A-Z_]{5})$`)
+
+// Camera makes by the start of their DCIM folder suffix
+var dcimFolderMakes = []struct {
+	prefix string
+	make   string
+}{
+	{"CANON", "Canon"},
+	{"EOS", "Canon"},
+	{"NIKON", "Nikon"},
+	{"NCD", "Nikon"},
+	{"MSDCF", "Sony"},
+	{"_FUJI", "Fujifilm"},
+	{"FUJI", "Fujifilm"},
+	{"OLYMP", "Olympus"},
+	{"OMSYS", "OM System"},
+	{"_PANA", "Panasonic"},
+	{"PANA", "Panasonic"},
+	{"RICOH", "Ricoh"},
+	{"PENTX", "Pentax"},
+	{"_PENT", "Pentax"},
+	{"LEICA", "Leica"},
+	{"GOPRO", "GoPro"},
+	{"HASBL", "Hasselblad"},
+	{"SIGMA", "Sigma"},
+}
+
+// volumeInfo is what the platform reports about a mounted filesystem
+type volumeInfo struct {
+	Serial         string
+	FilesystemType string
+	Free           uint64
+	Total          uint64
+	ReadOnly       bool
+}
+
+// maxCameraMakeFiles limits how many files are tried when reading the camera
+// make from Exif
+const maxCameraMakeFiles = 5
+
+// describeDisk fills in the volume, space and camera details of a mounted
+// partition, and its stable ID
+func describeDisk(disk *DiskInfo) {
+	if disk.MountPoint != "" {
+		if volume, err := readVolumeInfo(disk.MountPoint, disk.Device); err == nil {
+			if volume.Serial != "" {
+				disk.UUID = volume.Serial
+			}
+			if volume.FilesystemType != "" {
+				disk.FilesystemType = volume.FilesystemType
+			}
+			disk.FreeSpace = volume.Free
+			if volume.Total >= volume.Free {
+				disk.UsedSpace = volume.Total - volume.Free
+			}
+			disk.ReadOnly = disk.ReadOnly || volume.ReadOnly
+		}
+
+		disk.HasDCIM, disk.CameraMake = detectCamera(disk.MountPoint)
+	}
+
+	disk.ID = diskID(*disk)
+}
+
+// diskID derives an ID from the filesystem serial or UUID, which cameras set
+// when formatting a card, so the same card gets the same ID each time it is
+// mounted. The serial is normalized as platforms format it differently.
+// Without one the label and size are used, which is less likely to be unique
+// and may differ between machines.
+func diskID(disk DiskInfo) string {
+	identity := normalizeVolumeSerial(disk.UUID)
+	if identity == "" {
+		identity = fmt.Sprintf("%s\x00%s\x00%d", disk.Label, disk.Model, disk.Size)
+	}
+
+	return fmt.Sprintf("%016x", xxhash.Sum64String(identity))
+}
+
+// normalizeVolumeSerial makes the same serial read on different platforms,
+// e.g. 1234-abcd or 1234ABCD, compare equal
+func normalizeVolumeSerial(serial string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, strings.TrimSpace(serial))
+}
+
+// detectCamera looks for a DCIM folder and guesses the camera make from the
+// names of its folders, or else from the Exif of the first raw files
+func detectCamera(mountPoint string) (bool, string) {
+	dcim := ""
+	entries, err := os.ReadDir(mountPoint)
+	if err != nil {
+		return false, ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.EqualFold(entry.Name(), "DCIM") {
+			dcim = filepath.Join(mountPoint, entry.Name())
+			break
+		}
+	}
+	if dcim == "" {
+		return false, ""
+	}
+
+	folders, err := os.ReadDir(dcim)
+	if err != nil {
+		return true, ""
+	}
+
+	for _, folder := range folders {
+		matches := dcimFolderRegexp.FindStringSubmatch(strings.ToUpper(folder.Name()))
+		if !folder.IsDir() || matches == nil {
+			continue
+		}
+		for _, known := range dcimFolderMakes {
+			if strings.HasPrefix(matches[1], known.prefix) {
+				return true, known.make
+			}
+		}
+	}
+
+	tried := 0
+	for _, folder := range folders {
+		if !folder.IsDir() {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(dcim, folder.Name()))
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			path := filepath.Join(dcim, folder.Name(), file.Name())
+			if file.IsDir() || !isAllowedExtension(path) {
+				continue
+			}
+
+			if meta, err := readRawMetadata(path); err == nil && meta.Make != "" {
+				return true, meta.Make
+			}
+
+			tried++
+			if tried >= maxCameraMakeFiles {
+				return true, ""
+			}
+		}
+	}
+
+	return true, ""
+}
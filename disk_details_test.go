@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestDiskID(t *testing.T) {
+	card := DiskInfo{UUID: "1234-ABCD", Label: "EOS_DIGITAL", FilesystemType: "vfat", Size: 64 << 30}
+
+	tests := []struct {
+		name string
+		disk DiskInfo
+		same bool
+	}{
+		{name: "same card", disk: card, same: true},
+		{name: "serial formatted by another platform", disk: DiskInfo{UUID: "1234abcd", FilesystemType: "FAT32", Size: 63 << 30}, same: true},
+		{name: "another filesystem type", disk: DiskInfo{UUID: "1234-ABCD", FilesystemType: "msdos"}, same: true},
+		{name: "another serial", disk: DiskInfo{UUID: "1234-ABCE", Label: "EOS_DIGITAL", FilesystemType: "vfat", Size: 64 << 30}},
+		{name: "no serial", disk: DiskInfo{Label: "EOS_DIGITAL", FilesystemType: "vfat", Size: 64 << 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := diskID(tt.disk) == diskID(card); same != tt.same {
+				t.Errorf("diskID(%+v) equal to the card's = %v, want %v", tt.disk, same, tt.same)
+			}
+		})
+	}
+}
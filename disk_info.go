@@ -5,7 +5,6 @@ import (
 	"strings"
 
 	"github.com/jaypipes/ghw"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type DiskInfo struct {
@@ -13,11 +12,39 @@ type DiskInfo struct {
 	Model      string
 	Size       uint64
 	MountPoint string
+	// Device is the system name of the partition, e.g. "sdb1", and Drive
+	// the name of the disk holding it, e.g. "sdb"
+	Device         string
+	Drive          string
+	UUID           string
+	FilesystemType string
+	FreeSpace      uint64
+	UsedSpace      uint64
+	ReadOnly       bool
+	HasDCIM        bool
+	CameraMake     string
+	// ID identifies a card across mounts and machines
+	ID string
+	// Virtual is set for folders registered as sources, and Camera for
+	// cameras connected over USB
+	Virtual bool
+	Camera  bool
 }
 
+// GetDiskInfo lists the partitions of removable disks, followed by the
+// virtual sources and the connected cameras
 func (a *App) GetDiskInfo() []DiskInfo {
-	env := runtime.Environment(a.ctx)
+	disks := listDisks()
+	for i := range disks {
+		describeDisk(&disks[i])
+	}
+
+	disks = append(disks, a.virtualDisks()...)
+	return append(disks, a.cameraDisks()...)
+}
 
+// listDisks returns the partitions of removable disks
+func listDisks() []DiskInfo {
 	block, err := ghw.Block()
 	if err != nil {
 		fmt.Printf("Error getting block storage info: %v", err)
@@ -53,46 +80,15 @@ func (a *App) GetDiskInfo() []DiskInfo {
 				}
 
 				diskInfos = append(diskInfos, DiskInfo{
-					Label:      label,
-					Model:      model,
-					Size:       partition.SizeBytes,
-					MountPoint: partition.MountPoint,
-				})
-			}
-		}
-
-		if env.BuildType == "dev" {
-			// In development mode, also add the test disk
-			for _, partition := range disk.Partitions {
-				var label string
-				var model string
-
-				if partition.FilesystemLabel != "" {
-					label = strings.TrimSpace(partition.FilesystemLabel)
-				}
-				if label == "" && partition.Label != "" {
-					label = strings.TrimSpace(partition.Label)
-				}
-				if label == "" && disk.Model != "" {
-					label = strings.TrimSpace(disk.Model)
-				}
-
-				if label != "FakeExternalDisk" {
-					continue // Skip non-Test disks in this section
-				}
-
-				if disk.Model != "" {
-					model = disk.Model
-				}
-				if model == "" {
-					model = "Unknown"
-				}
-
-				diskInfos = append(diskInfos, DiskInfo{
-					Label:      label,
-					Model:      model,
-					Size:       partition.SizeBytes,
-					MountPoint: partition.MountPoint,
+					Label:          label,
+					Model:          model,
+					Size:           partition.SizeBytes,
+					MountPoint:     partition.MountPoint,
+					Device:         partition.Name,
+					Drive:          disk.Name,
+					UUID:           partition.UUID,
+					FilesystemType: partition.Type,
+					ReadOnly:       partition.IsReadOnly,
 				})
 			}
 		}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// diskPollInterval is how often disks are listed when the platform gives no
+// notification of mount changes, and the longest wait when it does
+const diskPollInterval = 2 * time.Second
+
+// diskKey identifies a mounted partition between two listings
+func diskKey(disk DiskInfo) string {
+	return disk.MountPoint + "\x00" + disk.Label
+}
+
+// mountedDisks lists the removable partitions that are mounted, as only those
+// can be browsed, with their keys in the order they are listed
+func mountedDisks() (map[string]DiskInfo, []string) {
+	disks := map[string]DiskInfo{}
+	var order []string
+	for _, disk := range listDisks() {
+		key := diskKey(disk)
+		if disk.MountPoint != "" && disks[key].MountPoint == "" {
+			disks[key] = disk
+			order = append(order, key)
+		}
+	}
+	return disks, order
+}
+
+// watchDisks emits disk:added and disk:removed when removable partitions are
+// mounted or unmounted, until ctx is done. With autoOpenNewCard set, the
+// newest card is also announced with disk:open, and with queueNewCards set
+// every new card is queued for import.
+func (a *App) watchDisks(ctx context.Context) {
+	known, _ := mountedDisks()
+	for key, disk := range known {
+		describeDisk(&disk)
+		known[key] = disk
+	}
+
+	changes := watchMounts(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		case <-time.After(diskPollInterval):
+		}
+
+		// Cameras are not mounted, so they may have changed too
+		a.forgetCameraDisks()
+
+		current, order := mountedDisks()
+
+		// Only new disks are described, as reading their details takes time
+		var added []DiskInfo
+		for _, key := range order {
+			disk := current[key]
+			if previous, ok := known[key]; ok {
+				current[key] = previous
+				continue
+			}
+
+			describeDisk(&disk)
+			current[key] = disk
+			added = append(added, disk)
+		}
+		for key, disk := range known {
+			if _, ok := current[key]; !ok {
+				rt.LogInfof(a.ctx, "Disk removed: %s at %s", disk.Label, disk.MountPoint)
+				a.abortImportsFrom(disk.MountPoint)
+				rt.EventsEmit(a.ctx, "disk:removed", disk)
+			}
+		}
+		for _, disk := range added {
+			rt.LogInfof(a.ctx, "Disk added: %s at %s", disk.Label, disk.MountPoint)
+			rt.EventsEmit(a.ctx, "disk:added", disk)
+		}
+
+		known = current
+
+		if len(added) == 0 {
+			continue
+		}
+
+		configState := a.GetConfig()
+		if configState == nil {
+			continue
+		}
+
+		if configState.QueueNewCards {
+			for _, disk := range added {
+				if _, err := a.QueueImport(disk.MountPoint, nil); err != nil {
+					rt.LogErrorf(a.ctx, "failed to queue import of %s: %v", disk.MountPoint, err)
+				}
+			}
+		}
+
+		if configState.AutoOpenNewCard {
+			// Of the cards found in the same listing, the last one listed
+			// appeared last
+			newest := added[len(added)-1]
+
+			rt.LogDebugf(a.ctx, "Opening new disk %s", newest.MountPoint)
+			rt.EventsEmit(a.ctx, "disk:open", newest)
+		}
+	}
+}
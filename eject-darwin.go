@@ -0,0 +1,24 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func ejectDisk(disk DiskInfo) error {
+	output, err := exec.Command("diskutil", "eject", disk.MountPoint).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	// diskutil reports the process that kept the disk busy as dissenting
+	message := strings.TrimSpace(string(output))
+	if strings.Contains(message, "in use") || strings.Contains(message, "dissent") {
+		return busyDiskError(disk.MountPoint, nil)
+	}
+
+	return fmt.Errorf("failed to eject %s: %v: %s", disk.MountPoint, err, message)
+}
@@ -0,0 +1,109 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	udisksName          = "org.freedesktop.UDisks2"
+	udisksBlockPath     = "/org/freedesktop/UDisks2/block_devices/"
+	udisksErrorBusy     = "org.freedesktop.UDisks2.Error.DeviceBusy"
+	udisksErrorNotMount = "org.freedesktop.UDisks2.Error.NotMounted"
+)
+
+// ejectDisk unmounts the filesystem and ejects and powers off its drive
+// through udisks2, as a file manager does
+func ejectDisk(disk DiskInfo) error {
+	if disk.Device == "" {
+		return fmt.Errorf("unknown device for %s", disk.MountPoint)
+	}
+
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to D-Bus: %v", err)
+	}
+	defer conn.Close()
+
+	options := map[string]dbus.Variant{}
+	block := conn.Object(udisksName, dbus.ObjectPath(udisksBlockPath+disk.Device))
+
+	err = block.Call(udisksName+".Filesystem.Unmount", 0, options).Err
+	if dbusErr, ok := err.(dbus.Error); ok {
+		switch dbusErr.Name {
+		case udisksErrorNotMount:
+			err = nil
+		case udisksErrorBusy:
+			return busyDiskError(disk.MountPoint, openFileHolders(disk.MountPoint))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmount %s: %v", disk.MountPoint, err)
+	}
+
+	drivePath, err := block.GetProperty(udisksName + ".Block.Drive")
+	if err != nil {
+		return fmt.Errorf("failed to find the drive of %s: %v", disk.Device, err)
+	}
+	path, ok := drivePath.Value().(dbus.ObjectPath)
+	if !ok || path == "/" {
+		return nil
+	}
+
+	drive := conn.Object(udisksName, path)
+	if err := drive.Call(udisksName+".Drive.Eject", 0, options).Err; err != nil {
+		// Card readers often cannot eject, the card is unmounted regardless
+		return nil
+	}
+
+	if canPowerOff, err := drive.GetProperty(udisksName + ".Drive.CanPowerOff"); err == nil && canPowerOff.Value() == true {
+		drive.Call(udisksName+".Drive.PowerOff", 0, options)
+	}
+
+	return nil
+}
+
+// openFileHolders lists the programs with files open on mountPoint, as far
+// as /proc shows them to this user
+func openFileHolders(mountPoint string) []string {
+	processes, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for _, process := range processes {
+		fds, err := os.ReadDir(filepath.Join("/proc", process.Name(), "fd"))
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join("/proc", process.Name(), "fd", fd.Name()))
+			if err != nil || !isOnDisk(target, mountPoint) {
+				continue
+			}
+
+			comm, err := os.ReadFile(filepath.Join("/proc", process.Name(), "comm"))
+			if err == nil {
+				names[strings.TrimSpace(string(comm))] = true
+			}
+			break
+		}
+	}
+
+	var holders []string
+	for name := range names {
+		holders = append(holders, name)
+	}
+	sort.Strings(holders)
+
+	return holders
+}
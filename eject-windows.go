@@ -0,0 +1,75 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	fsctlLockVolume          = 0x00090018
+	fsctlDismountVolume      = 0x00090020
+	ioctlStorageMediaRemoval = 0x002D4804
+	ioctlStorageEjectMedia   = 0x002D4808
+
+	lockVolumeAttempts = 5
+)
+
+// ejectDisk locks, dismounts and ejects the volume, the same steps as
+// "Safely Remove Hardware". Locking fails while files are open.
+func ejectDisk(disk DiskInfo) error {
+	drive := strings.TrimSuffix(disk.MountPoint, `\`)
+	path, err := windows.UTF16PtrFromString(`\\.\` + drive)
+	if err != nil {
+		return err
+	}
+
+	handle, err := windows.CreateFile(path, windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", drive, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	var returned uint32
+	ioctl := func(code uint32, in []byte) error {
+		var inPtr *byte
+		if len(in) > 0 {
+			inPtr = &in[0]
+		}
+		return windows.DeviceIoControl(handle, code, inPtr, uint32(len(in)), nil, 0, &returned, nil)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = ioctl(fsctlLockVolume, nil)
+		if err == nil {
+			break
+		}
+		if attempt == lockVolumeAttempts {
+			if err == windows.ERROR_ACCESS_DENIED || err == windows.ERROR_SHARING_VIOLATION {
+				return busyDiskError(disk.MountPoint, nil)
+			}
+			return fmt.Errorf("failed to lock %s: %v", drive, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if err := ioctl(fsctlDismountVolume, nil); err != nil {
+		return fmt.Errorf("failed to dismount %s: %v", drive, err)
+	}
+
+	// PREVENT_MEDIA_REMOVAL with PreventMediaRemoval set to false
+	if err := ioctl(ioctlStorageMediaRemoval, []byte{0}); err != nil {
+		return fmt.Errorf("failed to allow removal of %s: %v", drive, err)
+	}
+
+	if err := ioctl(ioctlStorageEjectMedia, nil); err != nil {
+		return fmt.Errorf("failed to eject %s: %v", drive, err)
+	}
+
+	return nil
+}
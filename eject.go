@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// busyDiskError explains that a disk cannot be ejected because files on it
+// are open, naming the programs holding them when they are known
+func busyDiskError(mountPoint string, holders []string) error {
+	if len(holders) > 0 {
+		return fmt.Errorf("cannot eject %s: files on it are still open in %s. Close them and try again", mountPoint, strings.Join(holders, ", "))
+	}
+	return fmt.Errorf("cannot eject %s: files on it are still open. Close them and try again", mountPoint)
+}
+
+// isOnDisk reports whether path is mountPoint or inside it
+func isOnDisk(path string, mountPoint string) bool {
+	rel, err := filepath.Rel(mountPoint, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// EjectDisk unmounts the removable disk mounted at mountPoint and ejects it
+// so it can be removed safely
+func (a *App) EjectDisk(mountPoint string) error {
+	var disk *DiskInfo
+	for _, candidate := range listDisks() {
+		if candidate.MountPoint == mountPoint {
+			disk = &candidate
+			break
+		}
+	}
+	if disk == nil {
+		return fmt.Errorf("no removable disk is mounted at %s", mountPoint)
+	}
+
+	// Stop reading thumbnails from the disk, which would keep it busy
+	a.thumbnailJobMu.Lock()
+	if a.thumbnailJob != nil && isOnDisk(a.thumbnailJob.source, mountPoint) {
+		a.thumbnailJob.cancel()
+		a.thumbnailJob = nil
+	}
+	a.thumbnailJobMu.Unlock()
+
+	rt.LogInfof(a.ctx, "Ejecting %s (%s)", mountPoint, disk.Device)
+
+	if err := ejectDisk(*disk); err != nil {
+		rt.LogErrorf(a.ctx, "Failed to eject %s: %v", mountPoint, err)
+		return err
+	}
+
+	rt.EventsEmit(a.ctx, "disk:ejected", *disk)
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	ExiftoolSourceConfigured = "configured"
+	ExiftoolSourceSystem     = "system"
+	ExiftoolSourceEmbedded   = "embedded"
+)
+
+const exiftoolValidateTimeout = 10 * time.Second
+
+var exiftoolVersionRegexp = regexp.MustCompile(`^\d+\.\d+`)
+
+// ExiftoolCandidate is one exiftool that was considered during resolution
+type ExiftoolCandidate struct {
+	Source  string `json:"source"`
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ExiftoolInfo describes the exiftool in use and how it was chosen
+type ExiftoolInfo struct {
+	Path       string              `json:"path"`
+	Version    string              `json:"version"`
+	Source     string              `json:"source"`
+	Candidates []ExiftoolCandidate `json:"candidates"`
+}
+
+var (
+	exiftoolMu   sync.RWMutex
+	exiftoolInfo ExiftoolInfo
+	// the embedded exiftool, once extracted into the cache
+	extractedExiftoolPath string
+)
+
+// validateExiftool runs `exiftool -ver` and returns the reported version
+func validateExiftool(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), exiftoolValidateTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "-ver").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s -ver: %v", path, err)
+	}
+
+	version := strings.TrimSpace(string(output))
+	if !exiftoolVersionRegexp.MatchString(version) {
+		return "", fmt.Errorf("unexpected version output from %s: %q", path, version)
+	}
+
+	return version, nil
+}
+
+func systemExiftoolPath() (string, error) {
+	return exec.LookPath("exiftool")
+}
+
+// resolveExiftool picks the exiftool to use, trying the configured path, then
+// PATH, then the copy embedded in the application
+func resolveExiftool(ctx context.Context, configuredPath string) ExiftoolInfo {
+	var info ExiftoolInfo
+
+	try := func(source string, locate func() (string, error)) bool {
+		candidate := ExiftoolCandidate{Source: source}
+		defer func() {
+			info.Candidates = append(info.Candidates, candidate)
+		}()
+
+		path, err := locate()
+		if err != nil {
+			candidate.Error = err.Error()
+			return false
+		}
+		candidate.Path = path
+
+		version, err := validateExiftool(path)
+		if err != nil {
+			candidate.Error = err.Error()
+			return false
+		}
+		candidate.Version = version
+
+		info.Path = path
+		info.Version = version
+		info.Source = source
+
+		return true
+	}
+
+	if configuredPath != "" && try(ExiftoolSourceConfigured, func() (string, error) {
+		if _, err := os.Stat(configuredPath); err != nil {
+			return "", err
+		}
+		return filepath.Abs(configuredPath)
+	}) {
+		return info
+	}
+
+	if try(ExiftoolSourceSystem, systemExiftoolPath) {
+		return info
+	}
+
+	try(ExiftoolSourceEmbedded, func() (string, error) {
+		if extractedExiftoolPath != "" {
+			return extractedExiftoolPath, nil
+		}
+
+		path, err := extractPlatformSpecificExiftool(ctx)
+		if err != nil {
+			return "", err
+		}
+		extractedExiftoolPath = path
+
+		return path, nil
+	})
+
+	return info
+}
+
+// useExiftool resolves exiftool and makes it the one used by all commands
+func (a *App) useExiftool(configuredPath string) ExiftoolInfo {
+	exiftoolMu.Lock()
+	defer exiftoolMu.Unlock()
+
+	info := resolveExiftool(a.ctx, configuredPath)
+	exiftoolInfo = info
+	exiftool_path = info.Path
+
+	if info.Path == "" {
+		rt.LogErrorf(a.ctx, "No usable exiftool found: %+v", info.Candidates)
+	} else {
+		rt.LogInfof(a.ctx, "Using %s exiftool %s at %s", info.Source, info.Version, info.Path)
+	}
+
+	return info
+}
+
+// exiftoolCommand creates a command running the resolved exiftool
+func exiftoolCommand(args ...string) (*exec.Cmd, error) {
+	exiftoolMu.RLock()
+	defer exiftoolMu.RUnlock()
+
+	if exiftool_path == "" {
+		return nil, fmt.Errorf("exiftool is not available")
+	}
+
+	if exiftoolInfo.Source == ExiftoolSourceEmbedded {
+		if err := verifyExtractedExiftool(); err != nil {
+			return nil, fmt.Errorf("embedded exiftool failed verification: %v", err)
+		}
+	}
+
+	return exec.Command(exiftool_path, args...), nil
+}
+
+func (a *App) GetExiftoolInfo() ExiftoolInfo {
+	exiftoolMu.RLock()
+	defer exiftoolMu.RUnlock()
+
+	return exiftoolInfo
+}
+
+// SetExiftoolPath pins the exiftool binary to use. An empty path removes the
+// pin and resolves exiftool automatically again.
+func (a *App) SetExiftoolPath(path string) (ExiftoolInfo, error) {
+	if path != "" {
+		if _, err := validateExiftool(path); err != nil {
+			return a.GetExiftoolInfo(), err
+		}
+	}
+
+	if err := a.updateConfig(map[string]interface{}{"exiftoolPath": path}); err != nil {
+		return a.GetExiftoolInfo(), err
+	}
+
+	return a.useExiftool(path), nil
+}
+
+func (a *App) SelectExiftoolPath() (ExiftoolInfo, error) {
+	options := rt.OpenDialogOptions{
+		Title: "Select ExifTool",
+	}
+
+	path, err := rt.OpenFileDialog(a.ctx, options)
+	if err != nil {
+		return a.GetExiftoolInfo(), err
+	}
+
+	if path == "" {
+		return a.GetExiftoolInfo(), nil
+	}
+
+	return a.SetExiftoolPath(path)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/cespare/xxhash"
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Extractions of other versions are kept until they have not been used for
+// this long, as another copy of the app may still be running them
+const staleExiftoolAge = 30 * 24 * time.Hour
+
+type exiftoolFileStamp struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// extractedExiftool is the verified state of the extracted exiftool. The
+// stamps record each file as it was when its hash was last verified.
+type extractedExiftool struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	dir      string
+	manifest map[string]string
+	stamps   map[string]exiftoolFileStamp
+}
+
+var verifiedExiftool extractedExiftool
+
+func exiftoolCacheDir() string {
+	return filepath.Join(xdg.CacheHome, "PhotoImporter", "exiftool")
+}
+
+// parseExiftoolManifest parses a manifest written by scripts/manifest.go,
+// mapping slash separated paths to SHA-256 hashes
+func parseExiftoolManifest(data []byte) (map[string]string, error) {
+	manifest := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, path, ok := strings.Cut(line, "  ")
+		if !ok || len(hash) != sha256.Size*2 || path == "" {
+			return nil, fmt.Errorf("invalid manifest line %q", line)
+		}
+
+		manifest[path] = strings.ToLower(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+
+	return manifest, nil
+}
+
+// embeddedExiftoolHash identifies the embedded exiftool distribution by a hash
+// of its manifest
+func embeddedExiftoolHash(manifestData []byte) string {
+	return fmt.Sprintf("%x", xxhash.Sum64(manifestData))
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkEmbeddedExiftool makes sure the embedded files are exactly the ones in
+// the manifest
+func checkEmbeddedExiftool(exiftoolFS fs.FS, manifest map[string]string) error {
+	seen := 0
+	err := fs.WalkDir(exiftoolFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		expected, ok := manifest[path]
+		if !ok {
+			return fmt.Errorf("embedded file %s is not in the manifest", path)
+		}
+
+		data, err := fs.ReadFile(exiftoolFS, path)
+		if err != nil {
+			return err
+		}
+
+		if fmt.Sprintf("%x", sha256.Sum256(data)) != expected {
+			return fmt.Errorf("embedded file %s does not match the manifest", path)
+		}
+		seen++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if seen != len(manifest) {
+		return fmt.Errorf("manifest lists %d files but %d are embedded", len(manifest), seen)
+	}
+
+	return nil
+}
+
+// extractPlatformSpecificExiftool extracts the embedded exiftool into a
+// private directory in the user cache named after the hash of its manifest.
+// Files that already match the manifest are reused, anything else is
+// rewritten, unknown files are removed, and extractions of other versions
+// that have not been used for staleExiftoolAge are deleted.
+func extractPlatformSpecificExiftool(ctx context.Context) (string, error) {
+	exiftoolFS, err := embeddedExiftoolFS()
+	if err != nil {
+		return "", fmt.Errorf("failed to get exiftool_files sub FS: %v", err)
+	}
+
+	manifest, err := parseExiftoolManifest(exiftoolManifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to read exiftool manifest: %v", err)
+	}
+
+	if err := checkEmbeddedExiftool(exiftoolFS, manifest); err != nil {
+		return "", fmt.Errorf("embedded exiftool failed verification: %v", err)
+	}
+
+	hash := embeddedExiftoolHash(exiftoolManifest)
+	cacheDir := exiftoolCacheDir()
+	destDir := filepath.Join(cacheDir, hash)
+
+	if err := os.MkdirAll(destDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %v", destDir, err)
+	}
+
+	repaired := 0
+	for path, expected := range manifest {
+		destPath := filepath.Join(destDir, filepath.FromSlash(path))
+		if actual, err := sha256File(destPath); err == nil && actual == expected {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), 0700); err != nil {
+			return "", fmt.Errorf("failed to create directory %s: %v", filepath.Dir(destPath), err)
+		}
+
+		fileData, err := fs.ReadFile(exiftoolFS, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read embedded file %s: %v", path, err)
+		}
+
+		if err := writeFileAtomic(destPath, fileData, 0600); err != nil {
+			return "", fmt.Errorf("failed to write file %s: %v", destPath, err)
+		}
+		repaired++
+	}
+
+	if repaired > 0 {
+		rt.LogInfof(ctx, "Extracted %d exiftool files to %s", repaired, destDir)
+	}
+
+	// The modification time of the directory records when it was last used
+	now := time.Now()
+	if err := os.Chtimes(destDir, now, now); err != nil {
+		rt.LogWarningf(ctx, "failed to mark %s as used: %v", destDir, err)
+	}
+
+	exiftoolPath := filepath.Join(destDir, exiftoolName)
+	if err := restrictExiftoolDir(destDir, manifest, exiftoolPath); err != nil {
+		return "", err
+	}
+
+	verifiedExiftool.mu.Lock()
+	defer verifiedExiftool.mu.Unlock()
+
+	verifiedExiftool.ctx = ctx
+	verifiedExiftool.dir = destDir
+	verifiedExiftool.manifest = manifest
+	verifiedExiftool.stamps = map[string]exiftoolFileStamp{}
+	if err := verifiedExiftool.verifyLocked(); err != nil {
+		return "", fmt.Errorf("extracted exiftool failed verification: %v", err)
+	}
+
+	removeStaleExiftools(ctx, cacheDir, hash)
+
+	return exiftoolPath, nil
+}
+
+// restrictExiftoolDir removes files that are not in the manifest and makes
+// everything private to the current user
+func restrictExiftoolDir(destDir string, manifest map[string]string, exiftoolPath string) error {
+	return filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(destDir, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return os.Chmod(path, 0700)
+		}
+
+		if _, ok := manifest[filepath.ToSlash(rel)]; !ok {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove unexpected file %s: %v", path, err)
+			}
+			return nil
+		}
+
+		mode := os.FileMode(0600)
+		if path == exiftoolPath {
+			mode = 0700
+		}
+
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %v", path, err)
+		}
+
+		return nil
+	})
+}
+
+// verifyLocked checks every extracted file against the manifest. The entry
+// point that is run is hashed every time, as a modification can keep its size
+// and times. Library files whose size, modification time and mode are
+// unchanged since they were last hashed are not hashed again. Directories are
+// listed every time, as files that are not in the manifest could be loaded by
+// exiftool.
+func (e *extractedExiftool) verifyLocked() error {
+	dirs := map[string]bool{".": true}
+	for path := range e.manifest {
+		for dir := filepath.Dir(filepath.FromSlash(path)); dir != "."; dir = filepath.Dir(dir) {
+			dirs[filepath.ToSlash(dir)] = true
+		}
+	}
+
+	for dir := range dirs {
+		dirPath := filepath.Join(e.dir, filepath.FromSlash(dir))
+
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			rel := entry.Name()
+			if dir != "." {
+				rel = dir + "/" + rel
+			}
+
+			if _, ok := e.manifest[rel]; !ok && !dirs[rel] {
+				return fmt.Errorf("unexpected file %s", filepath.Join(dirPath, entry.Name()))
+			}
+		}
+	}
+
+	for path, expected := range e.manifest {
+		destPath := filepath.Join(e.dir, filepath.FromSlash(path))
+
+		info, err := os.Stat(destPath)
+		if err != nil {
+			return err
+		}
+
+		stamp := exiftoolFileStamp{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+		if previous, ok := e.stamps[path]; ok && previous == stamp && path != exiftoolName {
+			continue
+		}
+
+		actual, err := sha256File(destPath)
+		if err != nil {
+			return err
+		}
+
+		if actual != expected {
+			delete(e.stamps, path)
+			return fmt.Errorf("%s does not match the manifest", destPath)
+		}
+
+		e.stamps[path] = stamp
+	}
+
+	return nil
+}
+
+// verifyExtractedExiftool is called before running the embedded exiftool. If
+// a file has been modified the extraction is repaired and verified again.
+func verifyExtractedExiftool() error {
+	verifiedExiftool.mu.Lock()
+	ctx := verifiedExiftool.ctx
+	err := verifiedExiftool.verifyLocked()
+	verifiedExiftool.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+
+	rt.LogWarningf(ctx, "Extracted exiftool failed verification, extracting again: %v", err)
+	if _, err := extractPlatformSpecificExiftool(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// removeStaleExiftools removes extractions left behind by other versions
+// that have not been used for staleExiftoolAge
+func removeStaleExiftools(ctx context.Context, cacheDir string, current string) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == current {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleExiftoolAge {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(cacheDir, entry.Name())); err != nil {
+			rt.LogWarningf(ctx, "Failed to remove stale exiftool %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cespare/xxhash"
+)
+
+// quickIDBlockSize is how much is read from each end of a file by quickFileID
+const quickIDBlockSize = 64 * 1024
+
+// quickFileID identifies a file from its size, modification time and its first
+// and last blocks, without reading the rest of it. The first block holds the
+// header and metadata of raw files, so two different shots practically never
+// collide. It names cached thumbnails and is used as the selection ID, while
+// hashFile is kept for verifying imported files.
+func quickFileID(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := xxhash.New()
+
+	var header [16]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(info.Size()))
+	binary.LittleEndian.PutUint64(header[8:16], uint64(info.ModTime().UnixNano()))
+	h.Write(header[:])
+
+	size := info.Size()
+	if size <= 2*quickIDBlockSize {
+		if _, err := io.Copy(h, file); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+
+	buf := make([]byte, quickIDBlockSize)
+	for _, offset := range []int64{0, size - quickIDBlockSize} {
+		if _, err := file.ReadAt(buf, offset); err != nil {
+			return "", err
+		}
+		h.Write(buf)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -12,15 +12,18 @@ import {
 	View,
 	defaultTheme,
 } from '@adobe/react-spectrum';
-import { useEffect, useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import { FormProvider, useForm, useWatch } from 'react-hook-form';
 import { useShallow } from 'zustand/react/shallow';
 
 import {
+	ApplyDefaultSelection,
 	CopyOrConvert,
 	ExtractThumbnail,
 	ListFiles,
 	PictureDir,
+	SelectNew,
+	ValidateFiles,
 } from '../wailsjs/go/main/App';
 import type { main } from '../wailsjs/go/models';
 import { EventsOff, EventsOn, Quit } from '../wailsjs/runtime';
@@ -54,12 +57,14 @@ function App() {
 		selected,
 		setExtractedThumbnails,
 		setSelectedAll,
+		setSelectedPaths,
 		setSelectNone,
 		invert,
 	} = usePhotosStore(
 		useShallow((state) => ({
 			selected: state.selected,
 			setSelectedAll: state.setSelectedAll,
+			setSelectedPaths: state.setSelectedPaths,
 			setSelectNone: state.setSelectNone,
 			invert: state.invert,
 			extractedThumbnails: state.extractedThumbnails,
@@ -67,6 +72,8 @@ function App() {
 		})),
 	);
 	const [importing, setImporting] = useState(false);
+	// Set when a card was opened, until its thumbnails load
+	const pendingDefaultSelection = useRef(false);
 
 	const { data: config } = useConfigStoreQuery();
 	const { data: env } = useGetEnvQuery();
@@ -92,6 +99,10 @@ function App() {
 		const unsubscribeSelectNone = EventsOn('deselect-all', () =>
 			setSelectNone(),
 		);
+		const unsubscribeSelectNew = EventsOn('select-new', async () => {
+			const newFiles = await SelectNew(files);
+			setSelectedPaths((newFiles ?? []).map((file) => file.path));
+		});
 		const unsubscribeInvert = EventsOn('invert', () => invert());
 		const unsubscribeImportSelected = EventsOn('import-selected', () => {
 			copyOrConvertFile(selected.map((file) => file.original_path));
@@ -101,14 +112,23 @@ function App() {
 		return () => {
 			unsubscribeSelectAll();
 			unsubscribeSelectNone();
+			unsubscribeSelectNew();
 			unsubscribeInvert();
 			unsubscribeImportSelected();
 			EventsOff('select-all');
 			EventsOff('deselect-all');
+			EventsOff('select-new');
 			EventsOff('invert');
 			EventsOff('import-selected');
 		};
-	}, [invert, selected, setSelectedAll, setSelectNone]);
+	}, [
+		files,
+		invert,
+		selected,
+		setSelectedAll,
+		setSelectedPaths,
+		setSelectNone,
+	]);
 
 	useEffect(() => {
 		(async () => {
@@ -160,22 +180,43 @@ function App() {
 					result.status === 'fulfilled' ? result.value : ('' as any),
 				),
 			);
+
+			if (pendingDefaultSelection.current) {
+				pendingDefaultSelection.current = false;
+				ApplyDefaultSelection();
+			}
 		})();
 	}, [files, setExtractedThumbnails]);
 
 	useEffect(() => {
 		if (!formValues.sourceDisk) return;
 
+		let cancelled = false;
+
 		(async () => {
 			try {
 				const result: FileInfo[] = await ListFiles(formValues.sourceDisk ?? '');
 				console.info('Listed files:', result);
+				pendingDefaultSelection.current = true;
 				// @ts-expect-error
 				setFiles(result);
+
+				// Checking the files for damage reads them, so the listing shows first
+				// @ts-expect-error
+				const validated: FileInfo[] = await ValidateFiles(result);
+				console.info('Validated files:', validated);
+				if (!cancelled) {
+					// @ts-expect-error
+					setFiles(validated);
+				}
 			} catch (error) {
 				console.error('Error listing files:', error);
 			}
 		})();
+
+		return () => {
+			cancelled = true;
+		};
 	}, [formValues.sourceDisk]);
 
 	const handleClose = (): void => {
@@ -209,7 +250,7 @@ function App() {
 				gap="size-300"
 			>
 				<View gridArea="content">
-					<SlideList extractedThumbnails={extractedThumbnails} />
+					<SlideList extractedThumbnails={extractedThumbnails} files={files} />
 				</View>
 				<View gridArea="sidebar" elementType="aside" padding="5px">
 					<FormProvider {...methods}>
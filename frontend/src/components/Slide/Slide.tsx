@@ -1,20 +1,20 @@
-import { type FC, useEffect, useState } from 'react';
+import type { FC } from 'react';
 import { useShallow } from 'zustand/react/shallow';
 
 import { usePhotosStore } from '../../stores/photos.store';
+import type { FileInfo } from '../../types/File';
 import type { ImageInfo } from '../../types/ImageInfo';
 
-import { loadImage } from '../../utils/loadImage';
 import styles from './Slide.module.scss';
 
 interface Props {
 	item: ImageInfo;
+	file?: FileInfo;
 	alt: string;
 	title: string;
 }
 
-export const Slide: FC<Props> = ({ item, alt, title }): JSX.Element => {
-	const [image, setImage] = useState<string | undefined>(undefined);
+export const Slide: FC<Props> = ({ item, file, alt, title }): JSX.Element => {
 	const { isSelected, setSelected, removeSelected } = usePhotosStore(
 		useShallow((state) => ({
 			isSelected: state.isSelected,
@@ -23,14 +23,6 @@ export const Slide: FC<Props> = ({ item, alt, title }): JSX.Element => {
 		})),
 	);
 
-	useEffect(() => {
-		(async () => {
-			const loadedImage = await loadImage(item.thumbnail_path);
-			setImage(loadedImage);
-			console.info(loadedImage);
-		})();
-	}, [item.thumbnail_path]);
-
 	const handleChange = (
 		event: React.ChangeEvent<HTMLInputElement>,
 		item: ImageInfo,
@@ -54,7 +46,18 @@ export const Slide: FC<Props> = ({ item, alt, title }): JSX.Element => {
 			/>
 			<label className={styles.slide} htmlFor={item.thumbnail_path}>
 				<figure className={styles.figure}>
-					<img src={image} alt={alt} />
+					{file?.suspicious && (
+						<span
+							className={styles.warningBadge}
+							title={file.warnings?.join('\n')}
+						>
+							Damaged?
+						</span>
+					)}
+					{file?.already_imported && (
+						<span className={styles.importedBadge}>Imported</span>
+					)}
+					<img src={item.url} alt={alt} />
 					<figcaption className={styles.figcaption}>{title}</figcaption>
 				</figure>
 			</label>
@@ -1,4 +1,5 @@
 import type { FC } from 'react';
+import type { FileInfo } from '../../types/File';
 import type { ImageInfo } from '../../types/ImageInfo';
 import { getFilename } from '../../utils/getFilename';
 import { Slide } from '../Slide/Slide';
@@ -6,14 +7,25 @@ import styles from './SlideList.module.scss';
 
 interface Props {
 	extractedThumbnails: ImageInfo[];
+	files: FileInfo[];
 }
 
-export const SlideList: FC<Props> = ({ extractedThumbnails }): JSX.Element => {
+export const SlideList: FC<Props> = ({
+	extractedThumbnails,
+	files,
+}): JSX.Element => {
+	const filesByPath = new Map(files.map((file) => [file.path, file]));
+
 	return (
 		<ul className={styles.slideList}>
 			{extractedThumbnails.map((file) => (
 				<li key={file.original_path} className={styles.listItem}>
-					<Slide item={file} alt="" title={getFilename(file.original_path)} />
+					<Slide
+						item={file}
+						file={filesByPath.get(file.original_path)}
+						alt=""
+						title={getFilename(file.original_path)}
+					/>
 				</li>
 			))}
 		</ul>
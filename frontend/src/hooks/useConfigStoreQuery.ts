@@ -4,15 +4,28 @@ import * as ConfigStore from '../../wailsjs/go/wailsconfigstore/ConfigStore';
 import { CONFIG_STORE_FILENAME } from '../constants';
 
 export interface Config {
+	autoOpenNewCard?: boolean;
+	cacheMaxSize?: number;
 	compressedLossless?: boolean;
 	convertToDng?: boolean;
 	createSubFoldersPattern?: string;
 	customSubFolderName?: string;
+	defaultSelection?: 'all' | 'none' | 'new';
 	deleteOriginal?: boolean;
+	ejectWhenDone?: boolean;
 	embedOriginalRawFile?: boolean;
+	exiftoolPath?: string;
+	geotagMaxGap?: number;
+	geotagTimeOffset?: number;
+	geotagTimezone?: string;
+	geotagWriteSidecar?: boolean;
+	gpxFiles?: string[];
 	imageConversionMethod?: string;
+	importParallel?: boolean;
 	jpegPreviewSize?: string;
 	location?: string;
+	queueNewCards?: boolean;
+	virtualSources?: { name: string; path: string }[];
 }
 
 const QUERY_KEY = ['configStore', 'all'];
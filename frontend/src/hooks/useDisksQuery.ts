@@ -1,7 +1,9 @@
 import { useQuery } from '@tanstack/react-query';
+import { useEffect } from 'react';
 
 import { GetDiskInfo } from '../../wailsjs/go/main/App';
 import type { main } from '../../wailsjs/go/models';
+import { EventsOff, EventsOn } from '../../wailsjs/runtime';
 
 const QUERY_KEY = ['disks', 'all'];
 
@@ -15,10 +17,21 @@ const getDisks = async (): Promise<main.DiskInfo[]> => {
 };
 
 export const useDisksQuery = () => {
-	return useQuery<main.DiskInfo[], Error>({
+	const query = useQuery<main.DiskInfo[], Error>({
 		queryKey: QUERY_KEY,
 		queryFn: getDisks,
 		staleTime: 0,
 		gcTime: 0,
 	});
+
+	const { refetch } = query;
+
+	useEffect(() => {
+		EventsOn('disk:added', () => refetch());
+		EventsOn('disk:removed', () => refetch());
+
+		return () => EventsOff('disk:added', 'disk:removed');
+	}, [refetch]);
+
+	return query;
 };
@@ -13,6 +13,7 @@ export interface State {
 	setSelected: (items: ImageInfo | ImageInfo[]) => void;
 	removeSelected: (ids: string | string[]) => void;
 	setSelectedAll: () => void;
+	setSelectedPaths: (paths: string[]) => void;
 	setSelectNone: () => void;
 	invert: () => void;
 	setExtractedThumbnails: (thumbnails: ImageInfo[]) => void;
@@ -63,6 +64,18 @@ export const usePhotosStore = create<State>()(
 				`${STORE_NAME}/setSelectedAll`,
 			);
 		},
+		setSelectedPaths: (paths) => {
+			const wanted = new Set(paths);
+			set(
+				{
+					selected: get().extractedThumbnails.filter((item) =>
+						wanted.has(item.original_path),
+					),
+				},
+				false,
+				`${STORE_NAME}/setSelectedPaths`,
+			);
+		},
 		setSelectNone: () =>
 			set({ selected: [] }, false, `${STORE_NAME}/setSelectNone`),
 		invert: () => {
@@ -2,4 +2,9 @@ export type FileInfo = {
 	path: string;
 	is_file: boolean;
 	size?: number;
+	sharpness?: number;
+	cluster_id?: number;
+	already_imported?: boolean;
+	suspicious?: boolean;
+	warnings?: string[];
 };
@@ -0,0 +1,12 @@
+export interface ImageAnalysis {
+	hash: string;
+	width: number;
+	height: number;
+	red: number[];
+	green: number[];
+	blue: number[];
+	luma: number[];
+	highlights_clipped: number;
+	shadows_clipped: number;
+	overlay_url?: string;
+}
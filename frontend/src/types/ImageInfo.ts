@@ -1,5 +1,10 @@
 export interface ImageInfo {
 	thumbnail_path: string;
+	url: string;
 	original_path: string;
 	hash: string;
+	preview_available: boolean;
+	preview_source?: string;
+	orientation: number;
+	perceptual_hash?: string;
 }
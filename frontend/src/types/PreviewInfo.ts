@@ -0,0 +1,12 @@
+export interface PreviewInfo {
+	preview_path: string;
+	url: string;
+	tile_url: string;
+	original_path: string;
+	hash: string;
+	preview_available: boolean;
+	preview_source?: string;
+	width: number;
+	height: number;
+	orientation: number;
+}
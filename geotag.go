@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// defaultGeotagMaxGap is used when the config does not specify how far a
+// capture time may be from the nearest track point and still be matched.
+const defaultGeotagMaxGap = 5 * time.Minute
+
+type TrackPoint struct {
+	Time time.Time
+	Lat  float64
+	Lon  float64
+	Ele  *float64
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+}
+
+type gpxDocument struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// Track holds the points of one or more GPX files, sorted by time
+type Track []TrackPoint
+
+func loadGpxFiles(paths []string) (Track, error) {
+	var track Track
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GPX file %s: %v", path, err)
+		}
+
+		var doc gpxDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse GPX file %s: %v", path, err)
+		}
+
+		for _, trk := range doc.Tracks {
+			for _, seg := range trk.Segments {
+				for _, pt := range seg.Points {
+					if pt.Time == "" {
+						continue
+					}
+
+					t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(pt.Time))
+					if err != nil {
+						return nil, fmt.Errorf("invalid time %q in GPX file %s: %v", pt.Time, path, err)
+					}
+
+					track = append(track, TrackPoint{
+						Time: t,
+						Lat:  pt.Lat,
+						Lon:  pt.Lon,
+						Ele:  pt.Ele,
+					})
+				}
+			}
+		}
+	}
+
+	if len(track) == 0 {
+		return nil, fmt.Errorf("no timestamped track points found in GPX files")
+	}
+
+	sort.Slice(track, func(i, j int) bool {
+		return track[i].Time.Before(track[j].Time)
+	})
+
+	return track, nil
+}
+
+// Locate finds the position at time t. Between two points that are no more
+// than maxGap apart the position is interpolated, otherwise the nearest
+// point is used if it is within maxGap.
+func (track Track) Locate(t time.Time, maxGap time.Duration) (TrackPoint, bool) {
+	i := sort.Search(len(track), func(i int) bool {
+		return !track[i].Time.Before(t)
+	})
+
+	if i < len(track) && track[i].Time.Equal(t) {
+		return track[i], true
+	}
+
+	if i > 0 && i < len(track) {
+		before, after := track[i-1], track[i]
+		span := after.Time.Sub(before.Time)
+
+		if span <= maxGap {
+			ratio := float64(t.Sub(before.Time)) / float64(span)
+
+			point := TrackPoint{
+				Time: t,
+				Lat:  before.Lat + (after.Lat-before.Lat)*ratio,
+				Lon:  before.Lon + (after.Lon-before.Lon)*ratio,
+			}
+			if before.Ele != nil && after.Ele != nil {
+				ele := *before.Ele + (*after.Ele-*before.Ele)*ratio
+				point.Ele = &ele
+			}
+
+			return point, true
+		}
+	}
+
+	var nearest *TrackPoint
+	var nearestGap time.Duration
+
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(track) {
+			continue
+		}
+
+		gap := track[j].Time.Sub(t)
+		if gap < 0 {
+			gap = -gap
+		}
+
+		if nearest == nil || gap < nearestGap {
+			nearest = &track[j]
+			nearestGap = gap
+		}
+	}
+
+	if nearest == nil || nearestGap > maxGap {
+		return TrackPoint{}, false
+	}
+
+	return *nearest, true
+}
+
+// readCaptureTime returns the capture time of a file. When the file does not
+// record its own UTC offset, loc is used to interpret the camera clock.
+func readCaptureTime(filePath string, loc *time.Location) (time.Time, error) {
+	if meta, err := readRawMetadata(filePath); err == nil && meta.DateTimeOriginal != "" {
+		return parseCaptureTime(meta.DateTimeOriginal, meta.SubSecTimeOriginal, meta.OffsetTimeOriginal, loc)
+	}
+
+	cmd, err := exiftoolCommand("-T", "-DateTimeOriginal", "-SubSecTimeOriginal", "-OffsetTimeOriginal", filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to execute exiftool: %v", err)
+	}
+
+	fields := strings.Split(strings.TrimRight(string(output), "\r\n"), "\t")
+	for len(fields) < 3 {
+		fields = append(fields, "-")
+	}
+
+	return parseCaptureTime(fields[0], fields[1], fields[2], loc)
+}
+
+func parseCaptureTime(dateTime, subSec, offset string, loc *time.Location) (time.Time, error) {
+	dateTime = strings.TrimSpace(dateTime)
+	if dateTime == "" || dateTime == "-" {
+		return time.Time{}, fmt.Errorf("no DateTimeOriginal")
+	}
+
+	offset = strings.TrimSpace(offset)
+	if offset != "" && offset != "-" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", dateTime+offset); err == nil {
+			loc = t.Location()
+		}
+	}
+
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", dateTime, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DateTimeOriginal %q: %v", dateTime, err)
+	}
+
+	subSec = strings.TrimSpace(subSec)
+	if subSec != "" && subSec != "-" {
+		if frac, err := strconv.ParseFloat("0."+subSec, 64); err == nil {
+			t = t.Add(time.Duration(frac * float64(time.Second)))
+		}
+	}
+
+	return t, nil
+}
+
+func writeGeotag(filePath string, point TrackPoint, sidecar bool) error {
+	var args []string
+
+	if sidecar {
+		// XMP stores the hemisphere in the value itself
+		args = append(args,
+			fmt.Sprintf("-XMP:GPSLatitude=%f", point.Lat),
+			fmt.Sprintf("-XMP:GPSLongitude=%f", point.Lon),
+		)
+		if point.Ele != nil {
+			args = append(args,
+				fmt.Sprintf("-XMP:GPSAltitude=%f", math.Abs(*point.Ele)),
+				fmt.Sprintf("-XMP:GPSAltitudeRef#=%d", altitudeRef(*point.Ele)),
+			)
+		}
+
+		sidecarPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".xmp"
+		if _, err := os.Stat(sidecarPath); err == nil {
+			args = append(args, "-overwrite_original", sidecarPath)
+		} else {
+			args = append(args, "-o", sidecarPath, filePath)
+		}
+	} else {
+		latRef, lonRef := "N", "E"
+		if point.Lat < 0 {
+			latRef = "S"
+		}
+		if point.Lon < 0 {
+			lonRef = "W"
+		}
+
+		args = append(args,
+			fmt.Sprintf("-GPSLatitude=%f", math.Abs(point.Lat)),
+			"-GPSLatitudeRef="+latRef,
+			fmt.Sprintf("-GPSLongitude=%f", math.Abs(point.Lon)),
+			"-GPSLongitudeRef="+lonRef,
+		)
+		if point.Ele != nil {
+			args = append(args,
+				fmt.Sprintf("-GPSAltitude=%f", math.Abs(*point.Ele)),
+				fmt.Sprintf("-GPSAltitudeRef#=%d", altitudeRef(*point.Ele)),
+			)
+		}
+
+		args = append(args, "-overwrite_original", filePath)
+	}
+
+	cmd, err := exiftoolCommand(args...)
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("exiftool failed: %v, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+func altitudeRef(ele float64) int {
+	if ele < 0 {
+		return 1
+	}
+	return 0
+}
+
+// geotagger matches capture times against a track using the geotag settings
+// from the config
+type geotagger struct {
+	track    Track
+	maxGap   time.Duration
+	offset   time.Duration
+	location *time.Location
+	sidecar  bool
+}
+
+func newGeotagger(configState *Config) (*geotagger, error) {
+	track, err := loadGpxFiles(configState.GpxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &geotagger{
+		track:    track,
+		maxGap:   time.Duration(configState.GeotagMaxGap) * time.Second,
+		offset:   time.Duration(configState.GeotagTimeOffset) * time.Second,
+		location: time.Local,
+		sidecar:  configState.GeotagWriteSidecar,
+	}
+
+	if g.maxGap <= 0 {
+		g.maxGap = defaultGeotagMaxGap
+	}
+
+	if configState.GeotagTimezone != "" {
+		loc, err := time.LoadLocation(configState.GeotagTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geotag timezone %q: %v", configState.GeotagTimezone, err)
+		}
+		g.location = loc
+	}
+
+	return g, nil
+}
+
+// tag geotags dest using the capture time read from source. It reports
+// whether a matching track point was found.
+func (g *geotagger) tag(source, dest string) (bool, error) {
+	captureTime, err := readCaptureTime(source, g.location)
+	if err != nil {
+		return false, err
+	}
+
+	point, ok := g.track.Locate(captureTime.Add(g.offset), g.maxGap)
+	if !ok {
+		return false, nil
+	}
+
+	if err := writeGeotag(dest, point, g.sidecar); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (a *App) SelectGpxFiles() ([]string, error) {
+	options := rt.OpenDialogOptions{
+		Title: "Select GPX Tracks",
+		Filters: []rt.FileFilter{
+			{DisplayName: "GPX Tracks (*.gpx)", Pattern: "*.gpx;*.GPX"},
+		},
+	}
+
+	paths, err := rt.OpenMultipleFilesDialog(a.ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) > 0 {
+		if _, err := loadGpxFiles(paths); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
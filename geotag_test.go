@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrackLocate(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ele := func(v float64) *float64 { return &v }
+
+	track := Track{
+		{Time: start, Lat: 10, Lon: 20, Ele: ele(100)},
+		{Time: start.Add(2 * time.Minute), Lat: 12, Lon: 24, Ele: ele(200)},
+		// A gap longer than maxGap, e.g. the logger was switched off
+		{Time: start.Add(time.Hour), Lat: 50, Lon: 60},
+	}
+
+	tests := []struct {
+		name   string
+		t      time.Time
+		want   TrackPoint
+		wantOK bool
+	}{
+		{
+			name:   "exact point",
+			t:      start.Add(2 * time.Minute),
+			want:   TrackPoint{Lat: 12, Lon: 24, Ele: ele(200)},
+			wantOK: true,
+		},
+		{
+			name:   "interpolated between close points",
+			t:      start.Add(30 * time.Second),
+			want:   TrackPoint{Lat: 10.5, Lon: 21, Ele: ele(125)},
+			wantOK: true,
+		},
+		{
+			name:   "nearest point as a long gap starts",
+			t:      start.Add(2*time.Minute + time.Second),
+			want:   TrackPoint{Lat: 12, Lon: 24, Ele: ele(200)},
+			wantOK: true,
+		},
+		{
+			name:   "nearest point across a long gap",
+			t:      start.Add(58 * time.Minute),
+			want:   TrackPoint{Lat: 50, Lon: 60},
+			wantOK: true,
+		},
+		{
+			name:   "before the track within maxGap",
+			t:      start.Add(-4 * time.Minute),
+			want:   TrackPoint{Lat: 10, Lon: 20, Ele: ele(100)},
+			wantOK: true,
+		},
+		{
+			name: "before the track beyond maxGap",
+			t:    start.Add(-6 * time.Minute),
+		},
+		{
+			name: "in a long gap far from both points",
+			t:    start.Add(30 * time.Minute),
+		},
+		{
+			name: "after the track beyond maxGap",
+			t:    start.Add(2 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := track.Locate(tt.t, 5*time.Minute)
+			if ok != tt.wantOK {
+				t.Fatalf("Locate(%v) ok = %v, want %v", tt.t, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			if math.Abs(got.Lat-tt.want.Lat) > 1e-9 || math.Abs(got.Lon-tt.want.Lon) > 1e-9 {
+				t.Errorf("Locate(%v) = %v, %v, want %v, %v", tt.t, got.Lat, got.Lon, tt.want.Lat, tt.want.Lon)
+			}
+			switch {
+			case (got.Ele == nil) != (tt.want.Ele == nil):
+				t.Errorf("Locate(%v) elevation = %v, want %v", tt.t, got.Ele, tt.want.Ele)
+			case got.Ele != nil && math.Abs(*got.Ele-*tt.want.Ele) > 1e-9:
+				t.Errorf("Locate(%v) elevation = %v, want %v", tt.t, *got.Ele, *tt.want.Ele)
+			}
+		})
+	}
+}
+
+func TestTrackLocateEmpty(t *testing.T) {
+	if _, ok := Track(nil).Locate(time.Now(), time.Minute); ok {
+		t.Errorf("Locate on an empty track found a point")
+	}
+}
@@ -8,16 +8,17 @@ require (
 	github.com/AndreiTelteu/wails-configstore v0.0.2
 	github.com/adrg/xdg v0.5.3
 	github.com/cespare/xxhash v1.1.0
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/jaypipes/ghw v0.13.0
 	github.com/wailsapp/mimetype v1.4.1
 	github.com/wailsapp/wails/v2 v2.10.1
+	golang.org/x/sys v0.30.0
 )
 
 require (
 	github.com/StackExchange/wmi v1.2.1 // indirect
 	github.com/bep/debounce v1.2.1 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/jaypipes/pcidb v1.0.1 // indirect
 	github.com/jchv/go-winloader v0.0.0-20210711035445-715c2860da7e // indirect
@@ -40,7 +41,6 @@ require (
 	github.com/wailsapp/go-webview2 v1.0.19 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	howett.net/plist v1.0.0 // indirect
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"strconv"
+	"strings"
+)
+
+const jpegQuality = 90
+
+// toRGBA converts img to an *image.RGBA with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// orientImage applies an Exif orientation (1-8) so the image displays upright
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				sx, sy = x, h-1-y
+			case 5: // mirror horizontal and rotate 270 CW
+				sx, sy = y, x
+			case 6: // rotate 90 CW
+				sx, sy = y, h-1-x
+			case 7: // mirror horizontal and rotate 90 CW
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 270 CW
+				sx, sy = w-1-y, x
+			}
+
+			si := sy*src.Stride + sx*4
+			di := y*dst.Stride + x*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+// orientJPEG returns the JPEG data re-encoded upright for the orientation
+func orientJPEG(data []byte, orientation int) ([]byte, error) {
+	if orientation < 2 || orientation > 8 {
+		return data, nil
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JPEG: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orientImage(img, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// readOrientation returns the Exif orientation of a file, or 1 if it has none
+func readOrientation(path string) int {
+	if meta, err := readRawMetadata(path); err == nil {
+		return max(meta.Orientation, 1)
+	}
+
+	cmd, err := exiftoolCommand("-n", "-s3", "-Orientation", path)
+	if err != nil {
+		return 1
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 1
+	}
+
+	orientation, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+
+	return orientation
+}
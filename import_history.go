@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/cespare/xxhash"
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	SelectionAll  = "all"
+	SelectionNone = "none"
+	SelectionNew  = "new"
+)
+
+// ImportRecord is a file imported from a card
+type ImportRecord struct {
+	// Path is relative to the root of the card
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	Destination string    `json:"destination"`
+	Imported    time.Time `json:"imported"`
+}
+
+// ImportHistory is every file imported from a card, by quickFileID
+type ImportHistory struct {
+	DiskID string                  `json:"disk_id"`
+	Label  string                  `json:"label"`
+	Files  map[string]ImportRecord `json:"files"`
+}
+
+// importHistoryMu serialises updates of the history files, which the import
+// queue may write for several cards at once
+var importHistoryMu sync.Mutex
+
+func importHistoryDir() string {
+	return filepath.Join(xdg.DataHome, "PhotoImporter", "history")
+}
+
+func importHistoryPath(diskID string) string {
+	return filepath.Join(importHistoryDir(), diskID+".json")
+}
+
+// loadImportHistory reads the history of a card, which is empty when nothing
+// was imported from it yet
+func loadImportHistory(diskID string) (ImportHistory, error) {
+	history := ImportHistory{DiskID: diskID, Files: map[string]ImportRecord{}}
+
+	data, err := os.ReadFile(importHistoryPath(diskID))
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return history, fmt.Errorf("failed to read import history: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &history); err != nil {
+		return ImportHistory{DiskID: diskID, Files: map[string]ImportRecord{}}, fmt.Errorf("failed to parse import history: %v", err)
+	}
+	if history.Files == nil {
+		history.Files = map[string]ImportRecord{}
+	}
+
+	return history, nil
+}
+
+func (h ImportHistory) save() error {
+	if err := os.MkdirAll(importHistoryDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode import history: %v", err)
+	}
+
+	return writeFileAtomic(importHistoryPath(h.DiskID), data, 0644)
+}
+
+// cameraFileID identifies a file on a camera by its folder, name and listed
+// size. Files on cameras cannot be read quickly, and their port changes from
+// one connection to the next.
+func cameraFileID(p string, size int64) (string, error) {
+	_, _, inCamera, err := parseCameraPath(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x", xxhash.Sum64String(fmt.Sprintf("%s\x00%d", inCamera, size))), nil
+}
+
+// historyFileID identifies a listed file the way it is recorded in the
+// history
+func historyFileID(file FileInfo) (string, error) {
+	if isCameraPath(file.Path) {
+		return cameraFileID(file.Path, file.Size)
+	}
+	return quickFileID(file.Path)
+}
+
+// markImported sets AlreadyImported on the files found in the history of the
+// card at source. Only files with the size of an imported one are read to
+// compute their identity, which keeps listing a large card quick.
+func (a *App) markImported(source string, files []FileInfo) {
+	disk, ok := a.findDisk(source)
+	if !ok || disk.ID == "" {
+		return
+	}
+
+	importHistoryMu.Lock()
+	history, err := loadImportHistory(disk.ID)
+	importHistoryMu.Unlock()
+	if err != nil {
+		rt.LogWarningf(a.ctx, "%v", err)
+		return
+	}
+	if len(history.Files) == 0 {
+		return
+	}
+
+	sizes := map[int64]bool{}
+	for _, record := range history.Files {
+		sizes[record.Size] = true
+	}
+
+	marked := 0
+	for i := range files {
+		if !sizes[files[i].Size] {
+			continue
+		}
+
+		id, err := historyFileID(files[i])
+		if err != nil {
+			continue
+		}
+
+		if _, ok := history.Files[id]; ok {
+			files[i].AlreadyImported = true
+			marked++
+		}
+	}
+
+	rt.LogDebugf(a.ctx, "%d of %d files on %s were imported before", marked, len(files), disk.Label)
+}
+
+// recordImports adds the imported files to the history of the card at source
+func (a *App) recordImports(source string, imported []ImportedFile) {
+	if len(imported) == 0 {
+		return
+	}
+
+	disk, ok := a.findDisk(source)
+	if !ok || disk.ID == "" {
+		rt.LogWarningf(a.ctx, "not recording the import history of %s: unknown disk", source)
+		return
+	}
+
+	importHistoryMu.Lock()
+	defer importHistoryMu.Unlock()
+
+	history, err := loadImportHistory(disk.ID)
+	if err != nil {
+		// Start over rather than never recording again
+		rt.LogWarningf(a.ctx, "%v", err)
+	}
+	history.Label = disk.Label
+
+	now := time.Now()
+	for _, file := range imported {
+		if file.Status != ImportStatusImported {
+			continue
+		}
+
+		var listed FileInfo
+		if isCameraPath(file.Source) {
+			// Recorded with the size the camera listed, as the file may be
+			// deleted from the camera by now
+			listed = FileInfo{Path: file.Source, Size: file.cameraSize}
+		} else {
+			// The original is gone when it was moved
+			info, err := os.Stat(file.Source)
+			if err != nil {
+				continue
+			}
+			listed = FileInfo{Path: file.Source, Size: info.Size()}
+		}
+
+		id, err := historyFileID(listed)
+		if err != nil {
+			rt.LogWarningf(a.ctx, "failed to identify %q: %v", file.Source, err)
+			continue
+		}
+
+		path, err := filepath.Rel(source, file.Source)
+		if isCameraPath(file.Source) {
+			path, err = strings.TrimPrefix(file.Source, source), nil
+		}
+		if err != nil {
+			path = file.Source
+		}
+
+		history.Files[id] = ImportRecord{
+			Path:        filepath.ToSlash(path),
+			Size:        listed.Size,
+			Destination: file.Destination,
+			Imported:    now,
+		}
+	}
+
+	if err := history.save(); err != nil {
+		rt.LogErrorf(a.ctx, "failed to save the import history of %s: %v", disk.Label, err)
+	}
+}
+
+// GetImportHistory returns the files imported from the card at source
+func (a *App) GetImportHistory(source string) (ImportHistory, error) {
+	disk, ok := a.findDisk(source)
+	if !ok || disk.ID == "" {
+		return ImportHistory{}, fmt.Errorf("no disk is mounted at %s", source)
+	}
+
+	importHistoryMu.Lock()
+	defer importHistoryMu.Unlock()
+
+	return loadImportHistory(disk.ID)
+}
+
+// ClearImportHistory forgets the files imported from the card at source, so
+// all of them show as new again
+func (a *App) ClearImportHistory(source string) error {
+	disk, ok := a.findDisk(source)
+	if !ok || disk.ID == "" {
+		return fmt.Errorf("no disk is mounted at %s", source)
+	}
+
+	importHistoryMu.Lock()
+	defer importHistoryMu.Unlock()
+
+	if err := os.Remove(importHistoryPath(disk.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear import history: %v", err)
+	}
+
+	return nil
+}
+
+// SelectNew returns the files that were not imported before
+func (a *App) SelectNew(files []FileInfo) []FileInfo {
+	var selected []FileInfo
+	for _, file := range files {
+		if !file.AlreadyImported {
+			selected = append(selected, file)
+		}
+	}
+
+	return selected
+}
+
+func (a *App) selectNew() {
+	rt.EventsEmit(a.ctx, "select-new")
+	rt.LogDebug(a.ctx, "Select new event emitted")
+}
+
+// ApplyDefaultSelection selects the files of the card that was just opened as
+// set in DefaultSelection, which selects none when unset
+func (a *App) ApplyDefaultSelection() {
+	selection := SelectionNone
+	if configState := a.GetConfig(); configState != nil && configState.DefaultSelection != "" {
+		selection = configState.DefaultSelection
+	}
+
+	switch selection {
+	case SelectionAll:
+		a.selectAll()
+	case SelectionNew:
+		a.selectNew()
+	case SelectionNone:
+		a.selectNone()
+	default:
+		rt.LogWarningf(a.ctx, "unknown default selection %q", selection)
+	}
+}
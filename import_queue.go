@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	ImportJobQueued    = "queued"
+	ImportJobRunning   = "running"
+	ImportJobDone      = "done"
+	ImportJobFailed    = "failed"
+	ImportJobCancelled = "cancelled"
+)
+
+var importJobCounter atomic.Int64
+
+// ImportJob is the import of one card, with the settings it was queued with
+type ImportJob struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Label  string `json:"label"`
+	DiskID string `json:"disk_id"`
+	// Reader is the physical drive of the card. Jobs on the same reader run
+	// one after another.
+	Reader string       `json:"reader"`
+	Status string       `json:"status"`
+	Done   int          `json:"done"`
+	Total  int          `json:"total"`
+	Report ImportReport `json:"report"`
+	Error  string       `json:"error,omitempty"`
+
+	files   []string
+	config  Config
+	virtual bool
+	cancel  context.CancelFunc
+}
+
+// importQueue runs import jobs in the order they were queued. Jobs on the
+// same reader never run at the same time, and with ImportParallel set jobs on
+// different readers do.
+type importQueue struct {
+	mu      sync.Mutex
+	jobs    []*ImportJob
+	running map[string]bool // readers with a running job
+}
+
+func (q *importQueue) find(id string) *ImportJob {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of the job that is safe to send to the frontend
+func (q *importQueue) snapshot(job *ImportJob) ImportJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return *job
+}
+
+func (a *App) emitImportJob(event string, job *ImportJob) {
+	rt.EventsEmit(a.ctx, event, a.imports.snapshot(job))
+}
+
+// QueueImport adds an import of files from a card to the queue, with the
+// current settings. With no files, every raw file on the card is imported.
+func (a *App) QueueImport(source string, files []string) (ImportJob, error) {
+	configState := a.GetConfig()
+	if configState == nil {
+		return ImportJob{}, fmt.Errorf("could not read the config")
+	}
+
+	if len(files) == 0 {
+		listed, err := a.listSourceFiles(source)
+		if err != nil {
+			return ImportJob{}, fmt.Errorf("failed to list files on %s: %v", source, err)
+		}
+		for _, file := range listed {
+			files = append(files, file.Path)
+		}
+	}
+
+	job := &ImportJob{
+		ID:     fmt.Sprintf("import-%d", importJobCounter.Add(1)),
+		Source: source,
+		Reader: source,
+		Status: ImportJobQueued,
+		Total:  len(files),
+		files:  files,
+		config: *configState,
+	}
+
+	if disk, ok := a.findDisk(source); ok {
+		job.Label = disk.Label
+		job.DiskID = disk.ID
+		job.virtual = disk.Virtual || disk.Camera
+		if disk.Drive != "" {
+			job.Reader = disk.Drive
+		}
+	}
+
+	a.imports.mu.Lock()
+	a.imports.jobs = append(a.imports.jobs, job)
+	a.imports.mu.Unlock()
+
+	rt.LogInfof(a.ctx, "Queued import %s of %d files from %s", job.ID, job.Total, source)
+	a.emitImportJob("import:queued", job)
+
+	a.startImportJobs()
+
+	return a.imports.snapshot(job), nil
+}
+
+// startImportJobs starts the queued jobs that can run now. Whether jobs run
+// in parallel is decided by the current settings for the whole queue, as
+// jobs queued with different settings may share a reader.
+func (a *App) startImportJobs() {
+	parallel := false
+	if configState := a.GetConfig(); configState != nil {
+		parallel = configState.ImportParallel
+	}
+
+	a.imports.mu.Lock()
+	defer a.imports.mu.Unlock()
+
+	if a.imports.running == nil {
+		a.imports.running = map[string]bool{}
+	}
+
+	for _, job := range a.imports.jobs {
+		if job.Status != ImportJobQueued {
+			continue
+		}
+
+		if a.imports.running[job.Reader] || (!parallel && len(a.imports.running) > 0) {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(a.ctx)
+		job.cancel = cancel
+		job.Status = ImportJobRunning
+		a.imports.running[job.Reader] = true
+
+		go a.runImportJob(ctx, job)
+	}
+}
+
+func (a *App) runImportJob(ctx context.Context, job *ImportJob) {
+	rt.LogInfof(a.ctx, "Starting import %s from %s", job.ID, job.Source)
+	a.emitImportJob("import:started", job)
+
+	ctx, done := a.trackImport(ctx, job.Source)
+	defer done()
+
+	report, err := a.runImport(ctx, &job.config, job.files, func(imported ImportedFile) {
+		a.imports.mu.Lock()
+		job.Done++
+		a.imports.mu.Unlock()
+
+		a.emitImportJob("import:progress", job)
+	})
+	a.recordImports(job.Source, report.Files)
+
+	if err == nil && report.complete() && job.config.EjectWhenDone && !job.virtual {
+		if ejectErr := a.EjectDisk(job.Source); ejectErr != nil {
+			report.EjectError = ejectErr.Error()
+		} else {
+			report.Ejected = true
+		}
+	}
+
+	a.imports.mu.Lock()
+	job.Report = report
+	event := "import:done"
+	switch {
+	case errors.Is(err, errDiskRemoved):
+		job.Status = ImportJobFailed
+		job.Error = err.Error()
+		event = "import:failed"
+	case ctx.Err() != nil:
+		job.Status = ImportJobCancelled
+		event = "import:cancelled"
+	case err != nil:
+		job.Status = ImportJobFailed
+		job.Error = err.Error()
+		event = "import:failed"
+	default:
+		job.Status = ImportJobDone
+	}
+	job.cancel()
+	delete(a.imports.running, job.Reader)
+	a.imports.mu.Unlock()
+
+	rt.LogInfof(a.ctx, "Import %s from %s %s", job.ID, job.Source, job.Status)
+	a.emitImportJob(event, job)
+
+	a.startImportJobs()
+}
+
+// GetImportJobs returns every job of the queue, in the order they were queued
+func (a *App) GetImportJobs() []ImportJob {
+	a.imports.mu.Lock()
+	defer a.imports.mu.Unlock()
+
+	jobs := make([]ImportJob, 0, len(a.imports.jobs))
+	for _, job := range a.imports.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	return jobs
+}
+
+// CancelImportJob removes a queued job, or stops a running one after the file
+// being imported
+func (a *App) CancelImportJob(id string) {
+	a.imports.mu.Lock()
+
+	job := a.imports.find(id)
+	if job == nil {
+		a.imports.mu.Unlock()
+		return
+	}
+
+	switch job.Status {
+	case ImportJobQueued:
+		job.Status = ImportJobCancelled
+		a.imports.mu.Unlock()
+		a.emitImportJob("import:cancelled", job)
+	case ImportJobRunning:
+		job.cancel()
+		a.imports.mu.Unlock()
+	default:
+		a.imports.mu.Unlock()
+	}
+}
+
+// ClearFinishedImportJobs forgets the jobs that are no longer queued or
+// running
+func (a *App) ClearFinishedImportJobs() {
+	a.imports.mu.Lock()
+	defer a.imports.mu.Unlock()
+
+	var jobs []*ImportJob
+	for _, job := range a.imports.jobs {
+		if job.Status == ImportJobQueued || job.Status == ImportJobRunning {
+			jobs = append(jobs, job)
+		}
+	}
+	a.imports.jobs = jobs
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errInvalidLosslessJPEG = errors.New("invalid lossless JPEG data")
+
+// ljpegHuffman is a Huffman table in the decoding form of ITU T.81 F.2.2.3
+type ljpegHuffman struct {
+	maxCode [17]int
+	valPtr  [17]int
+	minCode [17]int
+	values  []byte
+}
+
+func newLJPEGHuffman(counts []byte, values []byte) *ljpegHuffman {
+	h := &ljpegHuffman{values: values}
+
+	code, k := 0, 0
+	for length := 1; length <= 16; length++ {
+		n := int(counts[length-1])
+		if n == 0 {
+			h.maxCode[length] = -1
+		} else {
+			h.valPtr[length] = k
+			h.minCode[length] = code
+			code += n
+			k += n
+			h.maxCode[length] = code - 1
+		}
+		code <<= 1
+	}
+
+	return h
+}
+
+// ljpegBits reads the entropy coded segment bit by bit, removing stuffed
+// zero bytes. Reading stops at a marker, after which only zeros are returned.
+type ljpegBits struct {
+	data   []byte
+	pos    int
+	acc    uint32
+	n      int
+	marker bool
+}
+
+func (b *ljpegBits) fill() {
+	for b.n <= 24 {
+		var c byte
+		if !b.marker && b.pos < len(b.data) {
+			c = b.data[b.pos]
+			if c == 0xFF {
+				if b.pos+1 < len(b.data) && b.data[b.pos+1] == 0x00 {
+					b.pos += 2
+				} else {
+					b.marker = true
+					c = 0
+				}
+			} else {
+				b.pos++
+			}
+		}
+		b.acc |= uint32(c) << (24 - b.n)
+		b.n += 8
+	}
+}
+
+func (b *ljpegBits) bits(n int) int {
+	if n == 0 {
+		return 0
+	}
+	b.fill()
+	v := int(b.acc >> (32 - n))
+	b.acc <<= n
+	b.n -= n
+	return v
+}
+
+// restart skips to the RSTn marker that follows a restart interval
+func (b *ljpegBits) restart() {
+	b.acc, b.n = 0, 0
+	b.marker = false
+	for b.pos+1 < len(b.data) {
+		if b.data[b.pos] == 0xFF && b.data[b.pos+1] >= 0xD0 && b.data[b.pos+1] <= 0xD7 {
+			b.pos += 2
+			return
+		}
+		b.pos++
+	}
+}
+
+func (b *ljpegBits) decode(h *ljpegHuffman) (int, error) {
+	code := 0
+	for length := 1; length <= 16; length++ {
+		code = code<<1 | b.bits(1)
+		if h.maxCode[length] >= 0 && code <= h.maxCode[length] {
+			i := h.valPtr[length] + code - h.minCode[length]
+			if i >= len(h.values) {
+				return 0, errInvalidLosslessJPEG
+			}
+			return int(h.values[i]), nil
+		}
+	}
+	return 0, errInvalidLosslessJPEG
+}
+
+// diff reads the difference coded with table h
+func (b *ljpegBits) diff(h *ljpegHuffman) (int, error) {
+	ssss, err := b.decode(h)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case ssss == 0:
+		return 0, nil
+	case ssss == 16:
+		return 32768, nil
+	case ssss > 16:
+		return 0, errInvalidLosslessJPEG
+	}
+
+	v := b.bits(ssss)
+	if v < 1<<(ssss-1) {
+		v -= 1<<ssss - 1
+	}
+	return v, nil
+}
+
+// decodeLosslessJPEG decodes a lossless (SOF3) JPEG, as used for raw data in
+// DNG files. The samples are returned interleaved, row by row. The size in
+// the frame header is not trusted: it must hold no more samples than a chunk
+// of chunkWidth by chunkHeight pixels of samplesPerPixel.
+func decodeLosslessJPEG(data []byte, chunkWidth, chunkHeight, samplesPerPixel int) (samples []uint16, width, height, components int, err error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, 0, 0, errInvalidLosslessJPEG
+	}
+
+	var precision, restartInterval int
+	var componentTables []int
+	var componentIDs []byte
+	tables := map[int]*ljpegHuffman{}
+
+	pos := 2
+	for {
+		for pos < len(data) && data[pos] == 0xFF && pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, 0, 0, 0, errInvalidLosslessJPEG
+		}
+
+		marker := data[pos+1]
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return nil, 0, 0, 0, errInvalidLosslessJPEG
+		}
+		segment := data[pos+4 : pos+2+size]
+		pos += 2 + size
+
+		switch marker {
+		case 0xC3:
+			if len(segment) < 6 {
+				return nil, 0, 0, 0, errInvalidLosslessJPEG
+			}
+			precision = int(segment[0])
+			height = int(binary.BigEndian.Uint16(segment[1:]))
+			width = int(binary.BigEndian.Uint16(segment[3:]))
+			components = int(segment[5])
+			if precision < 2 || precision > 16 || width == 0 || height == 0 || components == 0 || components > 4 || len(segment) < 6+3*components {
+				return nil, 0, 0, 0, errInvalidLosslessJPEG
+			}
+			if width*components*height > chunkWidth*samplesPerPixel*chunkHeight {
+				return nil, 0, 0, 0, fmt.Errorf("lossless JPEG of %dx%d is larger than its %dx%d chunk", width, height, chunkWidth, chunkHeight)
+			}
+			for i := 0; i < components; i++ {
+				componentIDs = append(componentIDs, segment[6+3*i])
+			}
+
+		case 0xC0, 0xC1, 0xC2, 0xC5, 0xC6, 0xC7, 0xC9, 0xCA, 0xCB, 0xCD, 0xCE, 0xCF:
+			return nil, 0, 0, 0, fmt.Errorf("not a lossless JPEG (SOF%d)", marker-0xC0)
+
+		case 0xC4:
+			for len(segment) >= 17 {
+				class := int(segment[0])
+				counts := segment[1:17]
+				total := 0
+				for _, n := range counts {
+					total += int(n)
+				}
+				if len(segment) < 17+total {
+					return nil, 0, 0, 0, errInvalidLosslessJPEG
+				}
+				tables[class&0x0F] = newLJPEGHuffman(counts, segment[17:17+total])
+				segment = segment[17+total:]
+			}
+
+		case 0xDD:
+			if len(segment) < 2 {
+				return nil, 0, 0, 0, errInvalidLosslessJPEG
+			}
+			restartInterval = int(binary.BigEndian.Uint16(segment))
+
+		case 0xDA:
+			if components == 0 || len(segment) < 1 {
+				return nil, 0, 0, 0, errInvalidLosslessJPEG
+			}
+			count := int(segment[0])
+			if count != components || len(segment) < 1+2*count+3 {
+				return nil, 0, 0, 0, fmt.Errorf("lossless JPEG with %d of %d components in a scan is not supported", count, components)
+			}
+
+			componentTables = make([]int, components)
+			for i := 0; i < count; i++ {
+				id := segment[1+2*i]
+				for c, componentID := range componentIDs {
+					if componentID == id {
+						componentTables[c] = int(segment[2+2*i] >> 4)
+					}
+				}
+			}
+
+			predictor := int(segment[1+2*count])
+			pointTransform := int(segment[3+2*count] & 0x0F)
+
+			for _, table := range componentTables {
+				if tables[table] == nil {
+					return nil, 0, 0, 0, errInvalidLosslessJPEG
+				}
+			}
+
+			samples, err = decodeLosslessScan(data[pos:], width, height, components, precision, predictor, pointTransform, restartInterval, tables, componentTables)
+			return samples, width, height, components, err
+		}
+	}
+}
+
+func decodeLosslessScan(data []byte, width, height, components, precision, predictor, pointTransform, restartInterval int, tables map[int]*ljpegHuffman, componentTables []int) ([]uint16, error) {
+	if predictor < 1 || predictor > 7 {
+		return nil, fmt.Errorf("unsupported lossless JPEG predictor %d", predictor)
+	}
+	if pointTransform >= precision {
+		return nil, errInvalidLosslessJPEG
+	}
+
+	rowSize := width * components
+	samples := make([]uint16, rowSize*height)
+	previous := make([]int, rowSize)
+	current := make([]int, rowSize)
+
+	bits := &ljpegBits{data: data}
+	mask := 1<<precision - 1
+	initial := 1 << (precision - pointTransform - 1)
+
+	// The first row of the scan, and the first row after each restart, is
+	// predicted from the left only
+	firstRow := true
+	resetAt := 0
+	mcus := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if restartInterval > 0 && mcus > 0 && mcus%restartInterval == 0 {
+				bits.restart()
+				firstRow = true
+				resetAt = x
+			}
+			mcus++
+
+			for c := 0; c < components; c++ {
+				i := x*components + c
+
+				var prediction int
+				switch {
+				case firstRow && x == resetAt:
+					prediction = initial
+				case firstRow:
+					prediction = current[i-components]
+				case x == 0:
+					prediction = previous[i]
+				default:
+					ra, rb, rc := current[i-components], previous[i], previous[i-components]
+					switch predictor {
+					case 1:
+						prediction = ra
+					case 2:
+						prediction = rb
+					case 3:
+						prediction = rc
+					case 4:
+						prediction = ra + rb - rc
+					case 5:
+						prediction = ra + (rb-rc)>>1
+					case 6:
+						prediction = rb + (ra-rc)>>1
+					case 7:
+						prediction = (ra + rb) >> 1
+					}
+				}
+
+				diff, err := bits.diff(tables[componentTables[c]])
+				if err != nil {
+					return nil, err
+				}
+
+				value := (prediction + diff) & mask
+				current[i] = value
+				samples[y*rowSize+i] = uint16(value << pointTransform)
+			}
+		}
+
+		firstRow = false
+		resetAt = 0
+		previous, current = current, previous
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testLosslessJPEG is a 2x2 lossless JPEG of one 8 bit component, predicted
+// from the left, holding 129 129 / 128 128
+func testLosslessJPEG() []byte {
+	return []byte{
+		0xFF, 0xD8,
+		// DHT: SSSS 0 is coded 0 and SSSS 1 is coded 10
+		0xFF, 0xC4, 0x00, 0x15, 0x00,
+		0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01,
+		// SOF3: 8 bits, 2x2, one component
+		0xFF, 0xC3, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x02, 0x01, 0x01, 0x11, 0x00,
+		// SOS: predictor 1, no point transform
+		0xFF, 0xDA, 0x00, 0x08, 0x01, 0x01, 0x00, 0x01, 0x00, 0x00,
+		// +1, 0, -1, 0
+		0xA8,
+		0xFF, 0xD9,
+	}
+}
+
+func TestDecodeLosslessJPEG(t *testing.T) {
+	valid := testLosslessJPEG()
+
+	baseline := bytes.Clone(valid)
+	baseline[bytes.Index(baseline, []byte{0xFF, 0xC3})+1] = 0xC0
+
+	tests := []struct {
+		name            string
+		data            []byte
+		chunkWidth      int
+		chunkHeight     int
+		samplesPerPixel int
+		wantErr         bool
+	}{
+		{name: "frame the size of its chunk", data: valid, chunkWidth: 2, chunkHeight: 2, samplesPerPixel: 1},
+		{name: "frame smaller than its chunk", data: valid, chunkWidth: 256, chunkHeight: 256, samplesPerPixel: 3},
+		{name: "frame wider than its chunk", data: valid, chunkWidth: 1, chunkHeight: 2, samplesPerPixel: 1, wantErr: true},
+		{name: "frame taller than its chunk", data: valid, chunkWidth: 2, chunkHeight: 1, samplesPerPixel: 1, wantErr: true},
+		{name: "empty chunk", data: valid, samplesPerPixel: 1, wantErr: true},
+		{name: "baseline JPEG", data: baseline, chunkWidth: 2, chunkHeight: 2, samplesPerPixel: 1, wantErr: true},
+		{name: "cut in the frame header", data: valid[:30], chunkWidth: 2, chunkHeight: 2, samplesPerPixel: 1, wantErr: true},
+		{name: "not a JPEG", data: []byte("II*\x00\x08\x00\x00\x00"), chunkWidth: 2, chunkHeight: 2, samplesPerPixel: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, width, height, components, err := decodeLosslessJPEG(tt.data, tt.chunkWidth, tt.chunkHeight, tt.samplesPerPixel)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeLosslessJPEG = %v, want an error", samples)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeLosslessJPEG: %v", err)
+			}
+
+			if width != 2 || height != 2 || components != 1 {
+				t.Errorf("decoded %dx%d with %d components, want 2x2 with 1", width, height, components)
+			}
+
+			want := []uint16{129, 129, 128, 128}
+			if len(samples) != len(want) {
+				t.Fatalf("decoded %d samples, want %d", len(samples), len(want))
+			}
+			for i := range want {
+				if samples[i] != want[i] {
+					t.Errorf("samples = %v, want %v", samples, want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -55,6 +55,12 @@ func main() {
 	selectMenu.AddText("Invert", keys.CmdOrCtrl("i"), func(_ *menu.CallbackData) {
 		app.invert()
 	})
+	selectMenu.AddText("Select Sharpest", keys.CmdOrCtrl("k"), func(_ *menu.CallbackData) {
+		app.selectSharpest()
+	})
+	selectMenu.AddText("Select New", keys.CmdOrCtrl("n"), func(_ *menu.CallbackData) {
+		app.selectNew()
+	})
 	customMenu.Append(menu.WindowMenu())
 
 	if isMacOS {
@@ -67,7 +73,8 @@ func main() {
 		Width:  1024,
 		Height: 768,
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: newAssetHandler(app.cache),
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
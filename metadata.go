@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errUnsupportedFormat = errors.New("unsupported file format")
+
+// RawMetadata holds the tags read natively from a raw file, without going
+// through exiftool
+type RawMetadata struct {
+	Make               string
+	Model              string
+	LensModel          string
+	DateTimeOriginal   string
+	SubSecTimeOriginal string
+	OffsetTimeOriginal string
+	Orientation        int
+	ExposureTime       float64
+	FNumber            float64
+	ISO                int
+	FocalLength        float64
+	Previews           []EmbeddedPreview
+
+	// size of the file, which previews must fit in
+	size int64
+}
+
+// maxPreviewSize is the largest embedded preview that is read. Full size
+// previews of high resolution bodies are a few MB.
+const maxPreviewSize = 64 << 20
+
+// EmbeddedPreview is the location of a JPEG image embedded in a raw file
+type EmbeddedPreview struct {
+	Offset int64
+	Length int64
+	Width  int
+	Height int
+}
+
+func readRawMetadata(path string) (*RawMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRawMetadata(file, info.Size())
+}
+
+func parseRawMetadata(r io.ReaderAt, size int64) (*RawMetadata, error) {
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errUnsupportedFormat
+	}
+
+	meta := &RawMetadata{size: size}
+
+	var err error
+	switch {
+	case bytes.HasPrefix(header, []byte(rafMagic)):
+		err = readRAFMetadata(r, size, meta)
+	case string(header[4:8]) == "ftyp":
+		err = readBMFFMetadata(r, size, meta)
+	case isTIFFHeader(header):
+		var t *tiffReader
+		t, err = newTIFFReader(r, 0, size)
+		if err == nil {
+			err = t.collect(meta)
+		}
+	default:
+		err = errUnsupportedFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// addPreview records a JPEG at offset if it is a baseline or progressive JPEG.
+// Lossless JPEG data (raw sensor data in CR2 and DNG files) is ignored, and
+// so are previews past the end of the file or too large to be real.
+func (meta *RawMetadata) addPreview(r io.ReaderAt, offset, length int64) {
+	if offset <= 0 || length <= 0 || length > maxPreviewSize || offset > meta.size-length {
+		return
+	}
+
+	for _, preview := range meta.Previews {
+		if preview.Offset == offset {
+			return
+		}
+	}
+
+	width, height, ok := jpegDimensions(r, offset, length)
+	if !ok {
+		return
+	}
+
+	meta.Previews = append(meta.Previews, EmbeddedPreview{
+		Offset: offset,
+		Length: length,
+		Width:  width,
+		Height: height,
+	})
+}
+
+// jpegSegments calls fn for each marker segment before the start of scan
+func jpegSegments(r io.ReaderAt, offset, length int64, fn func(marker byte, start, size int64) bool) bool {
+	soi := make([]byte, 2)
+	if _, err := r.ReadAt(soi, offset); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return false
+	}
+
+	pos := offset + 2
+	end := offset + length
+	header := make([]byte, 4)
+
+	for pos+4 <= end {
+		if _, err := r.ReadAt(header, pos); err != nil {
+			return false
+		}
+
+		if header[0] != 0xFF {
+			return false
+		}
+
+		marker := header[1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			return true
+		}
+
+		size := int64(binary.BigEndian.Uint16(header[2:4]))
+		if size < 2 {
+			return false
+		}
+
+		if !fn(marker, pos+4, size-2) {
+			return true
+		}
+
+		pos += 2 + size
+	}
+
+	return true
+}
+
+func jpegDimensions(r io.ReaderAt, offset, length int64) (int, int, bool) {
+	var width, height int
+	found := false
+
+	jpegSegments(r, offset, length, func(marker byte, start, size int64) bool {
+		// SOF markers other than DHT, JPG and DAC
+		if marker < 0xC0 || marker > 0xCF || marker == 0xC4 || marker == 0xC8 || marker == 0xCC {
+			return true
+		}
+
+		// Only baseline, extended sequential and progressive Huffman JPEGs
+		// are previews
+		if marker != 0xC0 && marker != 0xC1 && marker != 0xC2 {
+			return false
+		}
+
+		sof := make([]byte, 5)
+		if _, err := r.ReadAt(sof, start); err != nil {
+			return false
+		}
+
+		height = int(binary.BigEndian.Uint16(sof[1:3]))
+		width = int(binary.BigEndian.Uint16(sof[3:5]))
+		found = width > 0 && height > 0
+
+		return false
+	})
+
+	return width, height, found
+}
+
+// readJPEGExif reads the Exif APP1 segment of the JPEG at offset into meta
+func readJPEGExif(r io.ReaderAt, offset, length int64, meta *RawMetadata) error {
+	var exifStart, exifSize int64
+
+	jpegSegments(r, offset, length, func(marker byte, start, size int64) bool {
+		if marker != 0xE1 || size < 14 {
+			return true
+		}
+
+		header := make([]byte, 6)
+		if _, err := r.ReadAt(header, start); err != nil {
+			return true
+		}
+
+		if string(header) == "Exif\x00\x00" {
+			exifStart, exifSize = start+6, size-6
+			return false
+		}
+
+		return true
+	})
+
+	if exifStart == 0 {
+		return fmt.Errorf("no Exif data in embedded JPEG")
+	}
+
+	t, err := newTIFFReader(r, exifStart, exifSize)
+	if err != nil {
+		return err
+	}
+
+	return t.collect(meta)
+}
+
+// LargestPreview returns the embedded preview with the most pixels
+func (meta *RawMetadata) LargestPreview() (EmbeddedPreview, bool) {
+	var best EmbeddedPreview
+	for _, preview := range meta.Previews {
+		if preview.Width*preview.Height > best.Width*best.Height {
+			best = preview
+		}
+	}
+	return best, best.Length > 0
+}
+
+// SmallestPreview returns the smallest embedded preview whose longest side
+// is at least minSize, or the largest preview if none is big enough
+func (meta *RawMetadata) SmallestPreview(minSize int) (EmbeddedPreview, bool) {
+	var best EmbeddedPreview
+	for _, preview := range meta.Previews {
+		if max(preview.Width, preview.Height) < minSize {
+			continue
+		}
+		if best.Length == 0 || preview.Width*preview.Height < best.Width*best.Height {
+			best = preview
+		}
+	}
+
+	if best.Length == 0 {
+		return meta.LargestPreview()
+	}
+
+	return best, true
+}
+
+func readPreview(path string, preview EmbeddedPreview) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, preview.Length)
+	if _, err := file.ReadAt(data, preview.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read embedded preview: %v", err)
+	}
+
+	return data, nil
+}
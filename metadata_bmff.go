@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var (
+	// Canon CR3 metadata container inside moov
+	cr3MetadataUUID = []byte{0x85, 0xc0, 0xb6, 0x87, 0x82, 0x0f, 0x11, 0xe0, 0x81, 0x11, 0xf4, 0xce, 0x46, 0x2b, 0x6a, 0x48}
+	// Canon CR3 preview container at the top level
+	cr3PreviewUUID = []byte{0xea, 0xf4, 0x2b, 0x5e, 0x1c, 0x98, 0x4b, 0x88, 0xb9, 0xfb, 0xb7, 0xdc, 0x40, 0x6e, 0x4d, 0x16}
+)
+
+type bmffBox struct {
+	Type  string
+	UUID  []byte
+	Start int64 // start of the payload
+	End   int64
+}
+
+func readBMFFBoxes(r io.ReaderAt, start, end int64) ([]bmffBox, error) {
+	var boxes []bmffBox
+	header := make([]byte, 16)
+
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil, fmt.Errorf("failed to read box header at %d: %v", pos, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		box := bmffBox{Type: string(header[4:8]), Start: pos + 8}
+
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return nil, fmt.Errorf("failed to read box size at %d: %v", pos, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.Start += 8
+		}
+
+		if size < box.Start-pos || pos+size > end {
+			return nil, fmt.Errorf("invalid box size %d at %d", size, pos)
+		}
+		box.End = pos + size
+
+		if box.Type == "uuid" {
+			box.UUID = make([]byte, 16)
+			if _, err := r.ReadAt(box.UUID, box.Start); err != nil {
+				return nil, fmt.Errorf("failed to read box UUID at %d: %v", pos, err)
+			}
+			box.Start += 16
+		}
+
+		boxes = append(boxes, box)
+		pos = box.End
+	}
+
+	return boxes, nil
+}
+
+// readBMFFMetadata reads a Canon CR3 file. The Exif data is stored as
+// separate TIFF structures in CMT boxes and the previews in THMB and PRVW
+// boxes.
+func readBMFFMetadata(r io.ReaderAt, size int64, meta *RawMetadata) error {
+	boxes, err := readBMFFBoxes(r, 0, size)
+	if err != nil {
+		return err
+	}
+
+	if len(boxes) == 0 || boxes[0].Type != "ftyp" {
+		return errUnsupportedFormat
+	}
+
+	brand := make([]byte, 4)
+	if _, err := r.ReadAt(brand, boxes[0].Start); err != nil || string(brand) != "crx " {
+		return errUnsupportedFormat
+	}
+
+	for _, box := range boxes {
+		switch {
+		case box.Type == "moov":
+			children, err := readBMFFBoxes(r, box.Start, box.End)
+			if err != nil {
+				return err
+			}
+
+			for _, child := range children {
+				if child.Type == "uuid" && bytes.Equal(child.UUID, cr3MetadataUUID) {
+					if err := readCR3Metadata(r, child, meta); err != nil {
+						return err
+					}
+				}
+			}
+
+		case box.Type == "uuid" && bytes.Equal(box.UUID, cr3PreviewUUID):
+			// The PRVW box follows 8 bytes of unknown data
+			children, err := readBMFFBoxes(r, box.Start+8, box.End)
+			if err != nil {
+				continue
+			}
+
+			for _, child := range children {
+				if child.Type == "PRVW" {
+					addBoxPreview(r, child, meta)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func readCR3Metadata(r io.ReaderAt, container bmffBox, meta *RawMetadata) error {
+	children, err := readBMFFBoxes(r, container.Start, container.End)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		switch child.Type {
+		case "CMT1", "CMT2", "CMT4":
+			t, err := newTIFFReader(r, child.Start, child.End-child.Start)
+			if err != nil {
+				continue
+			}
+			if err := t.collect(meta); err != nil {
+				continue
+			}
+		case "THMB":
+			addBoxPreview(r, child, meta)
+		}
+	}
+
+	return nil
+}
+
+// addBoxPreview adds the JPEG stored in a THMB or PRVW box. Both start with a
+// short header of dimensions and sizes, so look for the start of image marker
+// instead of depending on the header layout of each version.
+func addBoxPreview(r io.ReaderAt, box bmffBox, meta *RawMetadata) {
+	header := make([]byte, min(32, box.End-box.Start))
+	if _, err := r.ReadAt(header, box.Start); err != nil {
+		return
+	}
+
+	i := bytes.Index(header, []byte{0xFF, 0xD8, 0xFF})
+	if i < 0 {
+		return
+	}
+
+	meta.addPreview(r, box.Start+int64(i), box.End-box.Start-int64(i))
+}
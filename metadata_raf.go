@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const rafMagic = "FUJIFILMCCD-RAW "
+
+// readRAFMetadata reads a Fujifilm RAF file. The header points at an
+// embedded JPEG which carries the Exif data.
+func readRAFMetadata(r io.ReaderAt, size int64, meta *RawMetadata) error {
+	header := make([]byte, 108)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("failed to read RAF header: %v", err)
+	}
+
+	jpegOffset := int64(binary.BigEndian.Uint32(header[84:88]))
+	jpegLength := int64(binary.BigEndian.Uint32(header[88:92]))
+	if jpegOffset == 0 || jpegLength == 0 || jpegOffset+jpegLength > size {
+		return fmt.Errorf("invalid RAF JPEG location")
+	}
+
+	meta.addPreview(r, jpegOffset, jpegLength)
+
+	if err := readJPEGExif(r, jpegOffset, jpegLength, meta); err != nil {
+		return err
+	}
+
+	if meta.Make == "" {
+		meta.Make = "FUJIFILM"
+	}
+	if meta.Model == "" {
+		meta.Model = strings.TrimRight(string(header[28:60]), "\x00 ")
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// testTIFFEntry is an IFD entry whose value fits in the entry
+type testTIFFEntry struct {
+	tag   uint16
+	typ   uint16
+	value uint32
+}
+
+// buildTIFF writes a little endian TIFF with a single IFD followed by data,
+// which starts at the returned offset
+func buildTIFF(entries []testTIFFEntry, data []byte) ([]byte, uint32) {
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+
+	binary.Write(&buf, binary.LittleEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(&buf, binary.LittleEndian, entry.tag)
+		binary.Write(&buf, binary.LittleEndian, entry.typ)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, entry.value)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+
+	dataOffset := uint32(buf.Len())
+	buf.Write(data)
+
+	return buf.Bytes(), dataOffset
+}
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseRawMetadataPreviews(t *testing.T) {
+	preview := testJPEG(t, 64, 48)
+
+	// The preview follows the IFD, whose size does not depend on the values
+	_, dataOffset := buildTIFF(make([]testTIFFEntry, 3), nil)
+
+	tests := []struct {
+		name   string
+		offset uint32
+		length uint32
+		// size of the file as reported, which may be larger than the data
+		size        int64
+		wantPreview bool
+	}{
+		{
+			name:        "preview in the file",
+			offset:      dataOffset,
+			length:      uint32(len(preview)),
+			wantPreview: true,
+		},
+		{
+			name:   "preview running past the end of the file",
+			offset: dataOffset,
+			length: uint32(len(preview)) + 1,
+		},
+		{
+			name:   "preview starting past the end of the file",
+			offset: 1 << 30,
+			length: uint32(len(preview)),
+		},
+		{
+			name:   "preview over the size cap",
+			offset: dataOffset,
+			length: maxPreviewSize + 1,
+			size:   1 << 32,
+		},
+		{
+			name:   "empty preview",
+			offset: dataOffset,
+		},
+		{
+			name:   "preview that is not a JPEG",
+			offset: 8,
+			length: 16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := buildTIFF([]testTIFFEntry{
+				{tag: tagOrientation, typ: tiffTypeShort, value: 6},
+				{tag: tagJPEGInterchange, typ: tiffTypeLong, value: tt.offset},
+				{tag: tagJPEGInterchangeLen, typ: tiffTypeLong, value: tt.length},
+			}, preview)
+
+			size := tt.size
+			if size == 0 {
+				size = int64(len(data))
+			}
+
+			meta, err := parseRawMetadata(bytes.NewReader(data), size)
+			if err != nil {
+				t.Fatalf("parseRawMetadata: %v", err)
+			}
+			if meta.Orientation != 6 {
+				t.Errorf("Orientation = %d, want 6", meta.Orientation)
+			}
+
+			if !tt.wantPreview {
+				if len(meta.Previews) != 0 {
+					t.Errorf("Previews = %+v, want none", meta.Previews)
+				}
+				return
+			}
+
+			want := EmbeddedPreview{Offset: int64(dataOffset), Length: int64(len(preview)), Width: 64, Height: 48}
+			if len(meta.Previews) != 1 || meta.Previews[0] != want {
+				t.Errorf("Previews = %+v, want %+v", meta.Previews, want)
+			}
+		})
+	}
+}
+
+func TestParseRawMetadataInvalid(t *testing.T) {
+	emptyIFD := []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "too short", data: []byte("II*")},
+		{name: "not a raw file", data: []byte("GIF89a, not a raw file")},
+		{name: "IFD without entries", data: emptyIFD},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := parseRawMetadata(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err == nil {
+				t.Errorf("parseRawMetadata = %+v, want an error", meta)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	tagNewSubFileType      = 0x00FE
+	tagImageWidth          = 0x0100
+	tagImageLength         = 0x0101
+	tagCompression         = 0x0103
+	tagMake                = 0x010F
+	tagModel               = 0x0110
+	tagStripOffsets        = 0x0111
+	tagOrientation         = 0x0112
+	tagStripByteCounts     = 0x0117
+	tagSubIFDs             = 0x014A
+	tagJPEGInterchange     = 0x0201
+	tagJPEGInterchangeLen  = 0x0202
+	tagRW2JpgFromRaw       = 0x002E
+	tagExposureTime        = 0x829A
+	tagFNumber             = 0x829D
+	tagExifIFD             = 0x8769
+	tagISO                 = 0x8827
+	tagDateTimeOriginal    = 0x9003
+	tagOffsetTimeOriginal  = 0x9011
+	tagFocalLength         = 0x920A
+	tagSubSecTimeOriginal  = 0x9291
+	tagLensModel           = 0xA434
+	maxTIFFValueSize       = 1 << 20
+	maxTIFFIFDs            = 64
+	maxTIFFEntriesPerIFD   = 1024
+	tiffTypeByte           = 1
+	tiffTypeASCII          = 2
+	tiffTypeShort          = 3
+	tiffTypeLong           = 4
+	tiffTypeRational       = 5
+	tiffTypeUndefined      = 7
+	tiffTypeSRational      = 10
+	tiffTypeIFD            = 13
+	tiffCompressionOldJPEG = 6
+	tiffCompressionJPEG    = 7
+)
+
+var tiffTypeSizes = map[uint16]int64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+type tiffEntry struct {
+	Tag    uint16
+	Type   uint16
+	Count  uint32
+	Offset int64 // absolute offset of the value in the file
+	Size   int64
+	inline []byte
+}
+
+type tiffIFD struct {
+	Offset  int64
+	Entries map[uint16]tiffEntry
+}
+
+// tiffReader reads a TIFF structure that starts at base within r. All offsets
+// stored in the structure are relative to base.
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	size  int64
+	order binary.ByteOrder
+	first int64
+}
+
+func isTIFFHeader(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+
+	switch string(header[:4]) {
+	case "II*\x00", "MM\x00*", "IIU\x00", "IIRO", "IIRS", "MMOR":
+		return true
+	}
+
+	return false
+}
+
+func newTIFFReader(r io.ReaderAt, base, size int64) (*tiffReader, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, base); err != nil {
+		return nil, fmt.Errorf("failed to read TIFF header: %v", err)
+	}
+
+	if !isTIFFHeader(header) {
+		return nil, errUnsupportedFormat
+	}
+
+	t := &tiffReader{r: r, base: base, size: size}
+	if header[0] == 'I' {
+		t.order = binary.LittleEndian
+	} else {
+		t.order = binary.BigEndian
+	}
+	t.first = int64(t.order.Uint32(header[4:8]))
+
+	return t, nil
+}
+
+func (t *tiffReader) readIFD(offset int64) (*tiffIFD, int64, error) {
+	buf := make([]byte, 2)
+	if _, err := t.r.ReadAt(buf, t.base+offset); err != nil {
+		return nil, 0, fmt.Errorf("failed to read IFD at %d: %v", offset, err)
+	}
+
+	count := int64(t.order.Uint16(buf))
+	if count == 0 || count > maxTIFFEntriesPerIFD {
+		return nil, 0, fmt.Errorf("invalid IFD entry count %d at %d", count, offset)
+	}
+
+	data := make([]byte, count*12+4)
+	if _, err := t.r.ReadAt(data, t.base+offset+2); err != nil {
+		return nil, 0, fmt.Errorf("failed to read IFD entries at %d: %v", offset, err)
+	}
+
+	ifd := &tiffIFD{Offset: offset, Entries: make(map[uint16]tiffEntry, count)}
+
+	for i := int64(0); i < count; i++ {
+		raw := data[i*12 : i*12+12]
+		entry := tiffEntry{
+			Tag:   t.order.Uint16(raw[0:2]),
+			Type:  t.order.Uint16(raw[2:4]),
+			Count: t.order.Uint32(raw[4:8]),
+		}
+
+		typeSize, ok := tiffTypeSizes[entry.Type]
+		if !ok {
+			continue
+		}
+
+		entry.Size = typeSize * int64(entry.Count)
+		if entry.Size <= 4 {
+			entry.Offset = t.base + offset + 2 + i*12 + 8
+			entry.inline = raw[8 : 8+entry.Size]
+		} else {
+			entry.Offset = t.base + int64(t.order.Uint32(raw[8:12]))
+			if entry.Offset+entry.Size > t.base+t.size {
+				continue
+			}
+		}
+
+		ifd.Entries[entry.Tag] = entry
+	}
+
+	next := int64(t.order.Uint32(data[count*12:]))
+
+	return ifd, next, nil
+}
+
+func (t *tiffReader) value(entry tiffEntry) ([]byte, error) {
+	if entry.inline != nil {
+		return entry.inline, nil
+	}
+
+	if entry.Size > maxTIFFValueSize {
+		return nil, fmt.Errorf("value of tag 0x%04x is too large", entry.Tag)
+	}
+
+	buf := make([]byte, entry.Size)
+	if _, err := t.r.ReadAt(buf, entry.Offset); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (t *tiffReader) uints(entry tiffEntry) []uint64 {
+	data, err := t.value(entry)
+	if err != nil {
+		return nil
+	}
+
+	values := make([]uint64, 0, entry.Count)
+	for i := 0; i < int(entry.Count); i++ {
+		switch entry.Type {
+		case tiffTypeByte, tiffTypeUndefined:
+			values = append(values, uint64(data[i]))
+		case tiffTypeShort:
+			values = append(values, uint64(t.order.Uint16(data[i*2:])))
+		case tiffTypeLong, tiffTypeIFD:
+			values = append(values, uint64(t.order.Uint32(data[i*4:])))
+		default:
+			return values
+		}
+	}
+
+	return values
+}
+
+func (t *tiffReader) uint(entry tiffEntry) (uint64, bool) {
+	values := t.uints(entry)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+func (t *tiffReader) floats(entry tiffEntry) []float64 {
+	if entry.Type != tiffTypeRational && entry.Type != tiffTypeSRational {
+		var values []float64
+		for _, v := range t.uints(entry) {
+			values = append(values, float64(v))
+		}
+		return values
+	}
+
+	data, err := t.value(entry)
+	if err != nil {
+		return nil
+	}
+
+	values := make([]float64, 0, entry.Count)
+	for i := 0; i < int(entry.Count); i++ {
+		var num, den float64
+		if entry.Type == tiffTypeSRational {
+			num = float64(int32(t.order.Uint32(data[i*8:])))
+			den = float64(int32(t.order.Uint32(data[i*8+4:])))
+		} else {
+			num = float64(t.order.Uint32(data[i*8:]))
+			den = float64(t.order.Uint32(data[i*8+4:]))
+		}
+		if den == 0 {
+			values = append(values, math.NaN())
+			continue
+		}
+		values = append(values, num/den)
+	}
+
+	return values
+}
+
+func (t *tiffReader) float(entry tiffEntry) (float64, bool) {
+	values := t.floats(entry)
+	if len(values) == 0 || math.IsNaN(values[0]) {
+		return 0, false
+	}
+	return values[0], true
+}
+
+func (t *tiffReader) string(entry tiffEntry) string {
+	if entry.Type != tiffTypeASCII && entry.Type != tiffTypeUndefined {
+		return ""
+	}
+
+	data, err := t.value(entry)
+	if err != nil {
+		return ""
+	}
+
+	if i := strings.IndexByte(string(data), 0); i >= 0 {
+		data = data[:i]
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// walk visits every IFD reachable from the first one, following the IFD
+// chain, SubIFDs and the Exif IFD
+func (t *tiffReader) walk() ([]*tiffIFD, error) {
+	var ifds []*tiffIFD
+	visited := map[int64]bool{}
+	queue := []int64{t.first}
+
+	for len(queue) > 0 && len(ifds) < maxTIFFIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+
+		if offset <= 0 || offset >= t.size || visited[offset] {
+			continue
+		}
+		visited[offset] = true
+
+		ifd, next, err := t.readIFD(offset)
+		if err != nil {
+			if len(ifds) == 0 {
+				return nil, err
+			}
+			continue
+		}
+		ifds = append(ifds, ifd)
+
+		var children []int64
+		if entry, ok := ifd.Entries[tagExifIFD]; ok {
+			if v, ok := t.uint(entry); ok {
+				children = append(children, int64(v))
+			}
+		}
+		if entry, ok := ifd.Entries[tagSubIFDs]; ok {
+			for _, v := range t.uints(entry) {
+				children = append(children, int64(v))
+			}
+		}
+
+		queue = append(children, queue...)
+		queue = append(queue, next)
+	}
+
+	return ifds, nil
+}
+
+// collect copies the tags we care about and any embedded JPEG previews from
+// the TIFF structure into meta. Values already set in meta are kept.
+func (t *tiffReader) collect(meta *RawMetadata) error {
+	ifds, err := t.walk()
+	if err != nil {
+		return err
+	}
+
+	for _, ifd := range ifds {
+		setString := func(tag uint16, dst *string) {
+			if entry, ok := ifd.Entries[tag]; ok && *dst == "" {
+				*dst = t.string(entry)
+			}
+		}
+
+		setString(tagMake, &meta.Make)
+		setString(tagModel, &meta.Model)
+		setString(tagLensModel, &meta.LensModel)
+		setString(tagDateTimeOriginal, &meta.DateTimeOriginal)
+		setString(tagSubSecTimeOriginal, &meta.SubSecTimeOriginal)
+		setString(tagOffsetTimeOriginal, &meta.OffsetTimeOriginal)
+
+		if entry, ok := ifd.Entries[tagOrientation]; ok && meta.Orientation == 0 {
+			if v, ok := t.uint(entry); ok && v >= 1 && v <= 8 {
+				meta.Orientation = int(v)
+			}
+		}
+		if entry, ok := ifd.Entries[tagISO]; ok && meta.ISO == 0 {
+			if v, ok := t.uint(entry); ok {
+				meta.ISO = int(v)
+			}
+		}
+		if entry, ok := ifd.Entries[tagExposureTime]; ok && meta.ExposureTime == 0 {
+			meta.ExposureTime, _ = t.float(entry)
+		}
+		if entry, ok := ifd.Entries[tagFNumber]; ok && meta.FNumber == 0 {
+			meta.FNumber, _ = t.float(entry)
+		}
+		if entry, ok := ifd.Entries[tagFocalLength]; ok && meta.FocalLength == 0 {
+			meta.FocalLength, _ = t.float(entry)
+		}
+
+		t.collectPreviews(ifd, meta)
+	}
+
+	return nil
+}
+
+func (t *tiffReader) collectPreviews(ifd *tiffIFD, meta *RawMetadata) {
+	if start, ok := ifd.Entries[tagJPEGInterchange]; ok {
+		if length, ok := ifd.Entries[tagJPEGInterchangeLen]; ok {
+			offset, ok1 := t.uint(start)
+			size, ok2 := t.uint(length)
+			if ok1 && ok2 {
+				meta.addPreview(t.r, t.base+int64(offset), int64(size))
+			}
+		}
+	}
+
+	if entry, ok := ifd.Entries[tagRW2JpgFromRaw]; ok && entry.Type == tiffTypeUndefined {
+		meta.addPreview(t.r, entry.Offset, entry.Size)
+	}
+
+	compression, _ := t.uint(ifd.Entries[tagCompression])
+	if compression != tiffCompressionOldJPEG && compression != tiffCompressionJPEG {
+		return
+	}
+
+	// A reduced resolution image, or an old style JPEG image in a CR2 IFD0.
+	// Lossless JPEG raw data is rejected by addPreview.
+	subFileType, _ := t.uint(ifd.Entries[tagNewSubFileType])
+	if subFileType&1 == 0 && compression != tiffCompressionOldJPEG {
+		return
+	}
+
+	offsets := t.uints(ifd.Entries[tagStripOffsets])
+	counts := t.uints(ifd.Entries[tagStripByteCounts])
+	if len(offsets) != 1 || len(counts) != 1 {
+		return
+	}
+
+	meta.addPreview(t.r, t.base+int64(offsets[0]), int64(counts[0]))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// defaultTileSize is used when a tile request does not give a size
+	defaultTileSize = 512
+	// maxTileSize limits the side of a tile
+	maxTileSize = 2048
+	// decodedPreviewCount is how many decoded previews are kept for tiling
+	decodedPreviewCount = 3
+)
+
+type PreviewResponse struct {
+	PreviewPath      string `json:"preview_path"`
+	URL              string `json:"url"`
+	TileURL          string `json:"tile_url"`
+	OriginalPath     string `json:"original_path"`
+	Hash             string `json:"hash"`
+	PreviewAvailable bool   `json:"preview_available"`
+	PreviewSource    string `json:"preview_source,omitempty"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	Orientation      int    `json:"orientation"`
+}
+
+func tileURL(hash string) string {
+	return "/tile/" + hash + ".jpg"
+}
+
+// decodedImageCache keeps the most recently tiled previews decoded, as a
+// loupe requests many tiles of the same image
+type decodedImageCache struct {
+	mu     sync.Mutex
+	size   int
+	hashes []string // most recently used last
+	images map[string]image.Image
+}
+
+var decodedPreviews = &decodedImageCache{
+	size:   decodedPreviewCount,
+	images: map[string]image.Image{},
+}
+
+func (c *decodedImageCache) get(hash string) (image.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if img, ok := c.images[hash]; ok {
+		c.use(hash)
+		return img, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(previewCacheDir(), hash+".jpg"))
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode preview: %v", err)
+	}
+
+	c.images[hash] = img
+	c.use(hash)
+
+	for len(c.hashes) > c.size {
+		delete(c.images, c.hashes[0])
+		c.hashes = c.hashes[1:]
+	}
+
+	return img, nil
+}
+
+// forget drops a preview removed from the disk cache
+func (c *decodedImageCache) forget(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.images, hash)
+	for i, h := range c.hashes {
+		if h == hash {
+			c.hashes = append(c.hashes[:i], c.hashes[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *decodedImageCache) use(hash string) {
+	for i, h := range c.hashes {
+		if h == hash {
+			c.hashes = append(c.hashes[:i], c.hashes[i+1:]...)
+			break
+		}
+	}
+	c.hashes = append(c.hashes, hash)
+}
+
+// GetPreview extracts the largest embedded image of a file, upright, into the
+// preview cache. Its URL serves the whole image and its tile URL serves
+// regions of it at 100%.
+func (a *App) GetPreview(path string) (PreviewResponse, error) {
+	return a.getSourcePreview(path, a.browsedSource())
+}
+
+// getSourcePreview extracts the preview of a file of source, which the cache
+// entries are tagged with
+func (a *App) getSourcePreview(path string, source string) (PreviewResponse, error) {
+	if !isCameraPath(path) {
+		return a.getPreview(path, source)
+	}
+
+	// Files on cameras are read from a downloaded copy
+	staged, err := stageCameraFile(a.ctx, path)
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+
+	response, err := a.getPreview(staged, source)
+	response.OriginalPath = path
+	return response, err
+}
+
+func (a *App) getPreview(path string, source string) (PreviewResponse, error) {
+	previewDir := previewCacheDir()
+
+	hash, err := quickFileID(path)
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+
+	previewPath := filepath.Join(previewDir, hash+".jpg")
+	orientation := readOrientation(path)
+
+	response := PreviewResponse{
+		PreviewPath:      previewPath,
+		URL:              previewURL(hash),
+		TileURL:          tileURL(hash),
+		OriginalPath:     path,
+		Hash:             hash,
+		PreviewAvailable: true,
+		Orientation:      orientation,
+	}
+
+	if cached, err := os.ReadFile(previewPath); err == nil {
+		if config, err := jpeg.DecodeConfig(bytes.NewReader(cached)); err == nil {
+			a.cache.lookup(CacheKindPreview, hash+".jpg", true)
+			rt.LogDebugf(a.ctx, "preview for %q, with hash %q already exists at %q", path, hash, previewPath)
+
+			response.Width = config.Width
+			response.Height = config.Height
+			return response, nil
+		}
+	}
+	a.cache.lookup(CacheKindPreview, hash+".jpg", false)
+
+	data, previewSource, err := extractPreviewData(path)
+	if errors.Is(err, errNoPreview) {
+		rt.LogWarningf(a.ctx, "no preview available for %q", path)
+
+		return PreviewResponse{
+			OriginalPath: path,
+			Hash:         hash,
+			Orientation:  orientation,
+		}, nil
+	}
+	if err != nil {
+		rt.LogErrorf(a.ctx, "failed to extract preview for %q: %v", path, err)
+		return PreviewResponse{}, err
+	}
+
+	// Embedded previews are stored unrotated
+	if oriented, err := orientJPEG(data, orientation); err == nil {
+		data = oriented
+	} else {
+		rt.LogWarningf(a.ctx, "failed to apply orientation %d to preview for %q: %v", orientation, path, err)
+	}
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return PreviewResponse{}, fmt.Errorf("failed to read preview size: %v", err)
+	}
+
+	if err := os.MkdirAll(previewDir, 0755); err != nil {
+		return PreviewResponse{}, fmt.Errorf("failed to create preview directory: %v", err)
+	}
+
+	if err := writeFileAtomic(previewPath, data, 0644); err != nil {
+		return PreviewResponse{}, fmt.Errorf("failed to write preview: %v", err)
+	}
+
+	a.cache.add(CacheKindPreview, hash, hash+".jpg", source)
+
+	response.PreviewSource = previewSource
+	response.Width = config.Width
+	response.Height = config.Height
+
+	return response, nil
+}
+
+// tileRect parses the x, y, w and h query parameters of a tile request and
+// clips the region to the image
+func tileRect(r *http.Request, bounds image.Rectangle) (image.Rectangle, bool) {
+	param := func(name string, fallback int) (int, bool) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return fallback, true
+		}
+		n, err := strconv.Atoi(value)
+		return n, err == nil
+	}
+
+	x, okX := param("x", 0)
+	y, okY := param("y", 0)
+	w, okW := param("w", defaultTileSize)
+	h, okH := param("h", defaultTileSize)
+	if !okX || !okY || !okW || !okH || w <= 0 || h <= 0 || w > maxTileSize || h > maxTileSize {
+		return image.Rectangle{}, false
+	}
+
+	rect := image.Rect(x, y, x+w, y+h).Add(bounds.Min).Intersect(bounds)
+	return rect, !rect.Empty()
+}
+
+// tileHandler serves a region of a cached preview at 100%, in the pixels of
+// the upright preview
+func tileHandler(cache *cacheIndex) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matches := cachedImageRegexp.FindStringSubmatch(r.PathValue("name"))
+		if matches == nil {
+			http.NotFound(w, r)
+			return
+		}
+		hash := matches[1]
+
+		img, err := decodedPreviews.get(hash)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		rect, ok := tileRect(r, img.Bounds())
+		if !ok {
+			http.Error(w, "invalid tile", http.StatusBadRequest)
+			return
+		}
+
+		tile := img
+		if sub, ok := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}); ok {
+			tile = sub.SubImage(rect)
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, tile, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			http.Error(w, "failed to encode tile", http.StatusInternalServerError)
+			return
+		}
+
+		cache.touch(CacheKindPreview, hash+".jpg")
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	// thumbnailMinSize is the smallest embedded preview, on its longest
+	// side, that is used for a thumbnail when a choice is available
+	thumbnailMinSize = 160
+	// thumbnailMinBytes is the equivalent for previews extracted with
+	// exiftool, which only reports their size in bytes
+	thumbnailMinBytes = 4 * 1024
+)
+
+const PreviewSourceNative = "Native"
+
+// Embedded images exiftool can extract, in order of preference for thumbnails
+var exiftoolPreviewTags = []string{"ThumbnailImage", "PreviewImage", "JpgFromRaw", "OtherImage"}
+
+var errNoPreview = errors.New("no preview available")
+
+var exiftoolBinarySizeRegexp = regexp.MustCompile(`^\(Binary data (\d+) bytes`)
+
+type previewCandidate struct {
+	Tag  string
+	Size int64
+}
+
+// exiftoolPreviewCandidates lists the embedded images exiftool can extract
+// from path, with their sizes in bytes
+func exiftoolPreviewCandidates(path string) ([]previewCandidate, error) {
+	args := []string{"-j"}
+	for _, tag := range exiftoolPreviewTags {
+		args = append(args, "-"+tag)
+	}
+	args = append(args, path)
+
+	cmd, err := exiftoolCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute exiftool: %v", err)
+	}
+
+	var results []map[string]interface{}
+	if err := json.Unmarshal(output, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse exiftool output: %v", err)
+	}
+
+	var candidates []previewCandidate
+	if len(results) == 0 {
+		return candidates, nil
+	}
+
+	for _, tag := range exiftoolPreviewTags {
+		value, ok := results[0][tag].(string)
+		if !ok {
+			continue
+		}
+
+		matches := exiftoolBinarySizeRegexp.FindStringSubmatch(value)
+		if len(matches) != 2 {
+			continue
+		}
+
+		size, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+
+		candidates = append(candidates, previewCandidate{Tag: tag, Size: size})
+	}
+
+	return candidates, nil
+}
+
+// orderThumbnailCandidates puts the images large enough for a thumbnail first,
+// in tag preference order, followed by the smaller ones largest first
+func orderThumbnailCandidates(candidates []previewCandidate) []previewCandidate {
+	var large, small []previewCandidate
+	for _, candidate := range candidates {
+		if candidate.Size >= thumbnailMinBytes {
+			large = append(large, candidate)
+		} else {
+			small = append(small, candidate)
+		}
+	}
+
+	sort.SliceStable(small, func(i, j int) bool {
+		return small[i].Size > small[j].Size
+	})
+
+	return append(large, small...)
+}
+
+// extractExiftoolPreview extracts one embedded image with exiftool and checks
+// that it is a JPEG
+func extractExiftoolPreview(path string, tag string) ([]byte, error) {
+	cmd, err := exiftoolCommand("-b", "-"+tag, path)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %v", tag, err)
+	}
+
+	if !bytes.HasPrefix(output, []byte{0xFF, 0xD8}) {
+		return nil, fmt.Errorf("%s is not a JPEG image", tag)
+	}
+
+	return output, nil
+}
+
+// extractThumbnailData returns the embedded image best suited for a thumbnail
+// and where it came from. The native reader is tried first, then each image
+// exiftool can extract, then decoding the raw data of DNG and TIFF files.
+// errNoPreview is returned when there is none.
+func extractThumbnailData(path string) ([]byte, string, error) {
+	if meta, err := readRawMetadata(path); err == nil {
+		if preview, ok := meta.SmallestPreview(thumbnailMinSize); ok {
+			if data, err := readPreview(path, preview); err == nil {
+				return data, PreviewSourceNative, nil
+			}
+		}
+	}
+
+	candidates, exiftoolErr := exiftoolPreviewCandidates(path)
+	for _, candidate := range orderThumbnailCandidates(candidates) {
+		data, err := extractExiftoolPreview(path, candidate.Tag)
+		if err != nil {
+			continue
+		}
+
+		return data, candidate.Tag, nil
+	}
+
+	// Decoding the raw data is slow, so it is the last resort
+	if data, err := decodeRawPreview(path); err == nil {
+		return data, PreviewSourceDecoded, nil
+	}
+
+	if exiftoolErr != nil {
+		return nil, "", exiftoolErr
+	}
+
+	return nil, "", errNoPreview
+}
+
+// extractPreviewData returns the largest embedded image, for viewing at full
+// size, and where it came from. errNoPreview is returned when there is none.
+func extractPreviewData(path string) ([]byte, string, error) {
+	if meta, err := readRawMetadata(path); err == nil {
+		if preview, ok := meta.LargestPreview(); ok {
+			if data, err := readPreview(path, preview); err == nil {
+				return data, PreviewSourceNative, nil
+			}
+		}
+	}
+
+	candidates, err := exiftoolPreviewCandidates(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Size > candidates[j].Size
+	})
+
+	for _, candidate := range candidates {
+		data, err := extractExiftoolPreview(path, candidate.Tag)
+		if err != nil {
+			continue
+		}
+
+		return data, candidate.Tag, nil
+	}
+
+	return nil, "", errNoPreview
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+)
+
+const (
+	tagBitsPerSample       = 0x0102
+	tagPhotometric         = 0x0106
+	tagSamplesPerPixel     = 0x0115
+	tagRowsPerStrip        = 0x0116
+	tagPlanarConfiguration = 0x011C
+	tagTileWidth           = 0x0142
+	tagTileLength          = 0x0143
+	tagTileOffsets         = 0x0144
+	tagTileByteCounts      = 0x0145
+	tagCFARepeatPatternDim = 0x828D
+	tagCFAPattern          = 0x828E
+	tagExifCFAPattern      = 0xA302
+	tagLinearizationTable  = 0xC618
+	tagBlackLevel          = 0xC61A
+	tagWhiteLevel          = 0xC61D
+	tagAsShotNeutral       = 0xC628
+	photometricCFA         = 32803
+	photometricLinearRaw   = 34892
+	tiffCompressionNone    = 1
+	// rawPreviewMaxSize is the longest side of an image decoded from raw data
+	rawPreviewMaxSize = 1024
+	maxRawChunkSize   = 256 << 20
+	// maxRawChunkSamples bounds the samples decoded from one strip or tile
+	maxRawChunkSamples = 1 << 27
+)
+
+const PreviewSourceDecoded = "Decoded"
+
+var errNoRawData = errors.New("no supported raw data")
+
+// rawImage describes the raw data of a DNG or TIFF file, stored in strips or
+// tiles, uncompressed or as lossless JPEG
+type rawImage struct {
+	t               *tiffReader
+	width, height   int
+	samplesPerPixel int
+	bitsPerSample   int
+	compression     uint64
+	// Colours of the 2x2 CFA pattern in row order, 0 red, 1 green, 2 blue.
+	// Only used for CFA data.
+	cfa           [4]int
+	isCFA         bool
+	linearization []uint64
+	black, white  float64
+	neutral       [3]float64
+
+	chunkWidth, chunkHeight int
+	offsets, sizes          []uint64
+}
+
+// findRawImage looks for full resolution CFA or linear raw data that can be
+// decoded natively
+func findRawImage(t *tiffReader) (*rawImage, error) {
+	ifds, err := t.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *rawImage
+	var neutral []float64
+	var exifCFA []uint64
+
+	for _, ifd := range ifds {
+		if entry, ok := ifd.Entries[tagAsShotNeutral]; ok && neutral == nil {
+			neutral = t.floats(entry)
+		}
+		if entry, ok := ifd.Entries[tagExifCFAPattern]; ok && exifCFA == nil {
+			exifCFA = t.uints(entry)
+		}
+
+		raw, ok := t.rawImageInIFD(ifd)
+		if !ok {
+			continue
+		}
+		if best == nil || raw.width*raw.height > best.width*best.height {
+			best = raw
+		}
+	}
+
+	if best == nil {
+		return nil, errNoRawData
+	}
+
+	if best.isCFA {
+		// The Exif CFAPattern starts with the repeat dimensions, two shorts
+		if best.cfa == [4]int{-1, -1, -1, -1} {
+			if len(exifCFA) != 8 || exifCFA[0]+exifCFA[1] != 2 || exifCFA[2]+exifCFA[3] != 2 {
+				return nil, fmt.Errorf("missing CFA pattern")
+			}
+			for i := range best.cfa {
+				best.cfa[i] = int(exifCFA[4+i])
+			}
+		}
+
+		for _, colour := range best.cfa {
+			if colour < 0 || colour > 2 {
+				return nil, fmt.Errorf("unsupported CFA pattern %v", best.cfa)
+			}
+		}
+	}
+
+	best.neutral = [3]float64{1, 1, 1}
+	if len(neutral) >= 3 && neutral[0] > 0 && neutral[1] > 0 && neutral[2] > 0 {
+		copy(best.neutral[:], neutral)
+	}
+
+	return best, nil
+}
+
+func (t *tiffReader) rawImageInIFD(ifd *tiffIFD) (*rawImage, bool) {
+	uintTag := func(tag uint16, fallback uint64) uint64 {
+		if entry, ok := ifd.Entries[tag]; ok {
+			if v, ok := t.uint(entry); ok {
+				return v
+			}
+		}
+		return fallback
+	}
+
+	photometric := uintTag(tagPhotometric, 0)
+	if photometric != photometricCFA && photometric != photometricLinearRaw {
+		return nil, false
+	}
+	if uintTag(tagNewSubFileType, 0)&1 != 0 || uintTag(tagPlanarConfiguration, 1) != 1 {
+		return nil, false
+	}
+
+	raw := &rawImage{
+		t:               t,
+		width:           int(uintTag(tagImageWidth, 0)),
+		height:          int(uintTag(tagImageLength, 0)),
+		samplesPerPixel: int(uintTag(tagSamplesPerPixel, 1)),
+		bitsPerSample:   int(uintTag(tagBitsPerSample, 1)),
+		compression:     uintTag(tagCompression, tiffCompressionNone),
+		isCFA:           photometric == photometricCFA,
+		cfa:             [4]int{-1, -1, -1, -1},
+	}
+
+	if raw.width == 0 || raw.height == 0 || raw.bitsPerSample == 0 || raw.bitsPerSample > 16 {
+		return nil, false
+	}
+	if raw.compression != tiffCompressionNone && raw.compression != tiffCompressionJPEG {
+		return nil, false
+	}
+	if raw.isCFA && raw.samplesPerPixel != 1 || !raw.isCFA && raw.samplesPerPixel != 3 {
+		return nil, false
+	}
+
+	if raw.isCFA {
+		dims := t.uints(ifd.Entries[tagCFARepeatPatternDim])
+		pattern := t.uints(ifd.Entries[tagCFAPattern])
+		if len(dims) == 2 && (dims[0] != 2 || dims[1] != 2) {
+			return nil, false
+		}
+		if len(pattern) == 4 {
+			for i, colour := range pattern {
+				raw.cfa[i] = int(colour)
+			}
+		}
+	}
+
+	if entry, ok := ifd.Entries[tagLinearizationTable]; ok {
+		raw.linearization = t.uints(entry)
+	}
+
+	if levels := t.floats(ifd.Entries[tagBlackLevel]); len(levels) > 0 {
+		for _, level := range levels {
+			raw.black += level
+		}
+		raw.black /= float64(len(levels))
+	}
+
+	raw.white = float64(uint64(1)<<raw.bitsPerSample - 1)
+	if len(raw.linearization) > 0 {
+		raw.white = float64(raw.linearization[len(raw.linearization)-1])
+	}
+	if levels := t.floats(ifd.Entries[tagWhiteLevel]); len(levels) > 0 {
+		raw.white = levels[0]
+	}
+	if raw.white <= raw.black {
+		return nil, false
+	}
+
+	if _, ok := ifd.Entries[tagTileOffsets]; ok {
+		raw.chunkWidth = int(uintTag(tagTileWidth, 0))
+		raw.chunkHeight = int(uintTag(tagTileLength, 0))
+		raw.offsets = t.uints(ifd.Entries[tagTileOffsets])
+		raw.sizes = t.uints(ifd.Entries[tagTileByteCounts])
+	} else {
+		raw.chunkWidth = raw.width
+		raw.chunkHeight = int(min(uintTag(tagRowsPerStrip, uint64(raw.height)), uint64(raw.height)))
+		raw.offsets = t.uints(ifd.Entries[tagStripOffsets])
+		raw.sizes = t.uints(ifd.Entries[tagStripByteCounts])
+	}
+
+	if raw.chunkWidth == 0 || raw.chunkHeight == 0 || len(raw.offsets) == 0 || len(raw.offsets) != len(raw.sizes) {
+		return nil, false
+	}
+	if uint64(raw.chunkWidth)*uint64(raw.samplesPerPixel)*uint64(raw.chunkHeight) > maxRawChunkSamples {
+		return nil, false
+	}
+
+	across := (raw.width + raw.chunkWidth - 1) / raw.chunkWidth
+	down := (raw.height + raw.chunkHeight - 1) / raw.chunkHeight
+	if len(raw.offsets) < across*down {
+		return nil, false
+	}
+
+	return raw, true
+}
+
+// decodeChunk returns the samples of one strip or tile, row by row, and the
+// number of samples in a row. A compressed chunk may hold fewer rows or
+// shorter rows than its size in the image, and the rest of it is left empty.
+func (raw *rawImage) decodeChunk(i int) ([]uint16, int, error) {
+	size := raw.sizes[i]
+	if size == 0 || size > maxRawChunkSize {
+		return nil, 0, fmt.Errorf("invalid raw data size %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := raw.t.r.ReadAt(data, raw.t.base+int64(raw.offsets[i])); err != nil {
+		return nil, 0, fmt.Errorf("failed to read raw data: %v", err)
+	}
+
+	rowSamples := raw.chunkWidth * raw.samplesPerPixel
+
+	if raw.compression == tiffCompressionJPEG {
+		samples, width, height, components, err := decodeLosslessJPEG(data, raw.chunkWidth, raw.chunkHeight, raw.samplesPerPixel)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Rows of whole pixels that fit in the chunk keep their layout
+		if frameRow := width * components; frameRow > rowSamples || frameRow%raw.samplesPerPixel != 0 || height > raw.chunkHeight {
+			return nil, 0, fmt.Errorf("lossless JPEG of %dx%d does not fit its %dx%d chunk", width, height, raw.chunkWidth, raw.chunkHeight)
+		}
+		return samples, width * components, nil
+	}
+
+	rowBytes := (rowSamples*raw.bitsPerSample + 7) / 8
+	rows := min(len(data)/rowBytes, raw.chunkHeight)
+	samples := make([]uint16, rows*rowSamples)
+
+	for y := 0; y < rows; y++ {
+		row := data[y*rowBytes : (y+1)*rowBytes]
+		out := samples[y*rowSamples : (y+1)*rowSamples]
+
+		switch raw.bitsPerSample {
+		case 8:
+			for x := range out {
+				out[x] = uint16(row[x])
+			}
+		case 16:
+			for x := range out {
+				out[x] = raw.t.order.Uint16(row[x*2:])
+			}
+		default:
+			// Packed most significant bit first, rows start on a byte
+			var acc uint32
+			bits, pos := 0, 0
+			for x := range out {
+				for bits < raw.bitsPerSample {
+					acc = acc<<8 | uint32(row[pos])
+					pos++
+					bits += 8
+				}
+				bits -= raw.bitsPerSample
+				out[x] = uint16(acc >> bits & (1<<raw.bitsPerSample - 1))
+			}
+		}
+	}
+
+	return samples, rowSamples, nil
+}
+
+// render decodes the raw data into a small RGB image. Each output pixel
+// averages a block of whole CFA patterns per colour, which is a simple
+// demosaic, then the white balance and an sRGB tone curve are applied.
+func (raw *rawImage) render() (image.Image, error) {
+	step := 1
+	if raw.isCFA {
+		step = 2
+	}
+	factor := step
+	for max(raw.width, raw.height)/factor > rawPreviewMaxSize {
+		factor += step
+	}
+
+	outWidth := (raw.width + factor - 1) / factor
+	outHeight := (raw.height + factor - 1) / factor
+	sums := make([]float64, outWidth*outHeight*3)
+	counts := make([]uint32, outWidth*outHeight*3)
+
+	across := (raw.width + raw.chunkWidth - 1) / raw.chunkWidth
+	down := (raw.height + raw.chunkHeight - 1) / raw.chunkHeight
+
+	for i := 0; i < across*down; i++ {
+		samples, rowSamples, err := raw.decodeChunk(i)
+		if err != nil {
+			return nil, err
+		}
+
+		x0 := (i % across) * raw.chunkWidth
+		y0 := (i / across) * raw.chunkHeight
+		cols := rowSamples / raw.samplesPerPixel
+
+		for row := 0; row < raw.chunkHeight && (row+1)*rowSamples <= len(samples); row++ {
+			y := y0 + row
+			if y >= raw.height {
+				break
+			}
+
+			for col := 0; col < cols; col++ {
+				x := x0 + col
+				if x >= raw.width {
+					break
+				}
+
+				pixel := ((y/factor)*outWidth + x/factor) * 3
+				for s := 0; s < raw.samplesPerPixel; s++ {
+					value := samples[row*rowSamples+col*raw.samplesPerPixel+s]
+					if len(raw.linearization) > 0 {
+						value = uint16(raw.linearization[min(int(value), len(raw.linearization)-1)])
+					}
+
+					colour := s
+					if raw.isCFA {
+						colour = raw.cfa[(y%2)*2+x%2]
+					}
+
+					sums[pixel+colour] += float64(value)
+					counts[pixel+colour]++
+				}
+			}
+		}
+	}
+
+	// White balance multipliers that keep green unchanged
+	var balance [3]float64
+	for c := range balance {
+		balance[c] = raw.neutral[1] / raw.neutral[c]
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for p := 0; p < outWidth*outHeight; p++ {
+		for c := 0; c < 3; c++ {
+			if counts[p*3+c] == 0 {
+				continue
+			}
+
+			value := sums[p*3+c] / float64(counts[p*3+c])
+			value = (value - raw.black) / (raw.white - raw.black) * balance[c]
+			img.Pix[p*4+c] = uint8(math.Round(255 * srgbGamma(min(max(value, 0), 1))))
+		}
+		img.Pix[p*4+3] = 255
+	}
+
+	return img, nil
+}
+
+func srgbGamma(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// decodeRawPreview decodes the raw data of a DNG or TIFF file into a small
+// JPEG, for files without any usable embedded preview. The image is in the
+// orientation of the sensor.
+func decodeRawPreview(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newTIFFReader(file, 0, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := findRawImage(t)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := raw.render()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+func TestRenderLosslessJPEGChunks(t *testing.T) {
+	data := testLosslessJPEG()
+
+	rawWithChunk := func(chunkWidth, chunkHeight int) *rawImage {
+		return &rawImage{
+			t:               &tiffReader{r: bytes.NewReader(data), size: int64(len(data)), order: binary.LittleEndian},
+			width:           4,
+			height:          2,
+			samplesPerPixel: 1,
+			bitsPerSample:   8,
+			compression:     tiffCompressionJPEG,
+			white:           255,
+			neutral:         [3]float64{1, 1, 1},
+			chunkWidth:      chunkWidth,
+			chunkHeight:     chunkHeight,
+			offsets:         []uint64{0, 0},
+			sizes:           []uint64{uint64(len(data)), uint64(len(data))},
+		}
+	}
+
+	// A 2x2 frame in a 4x2 chunk fills its left half
+	img, err := rawWithChunk(4, 2).render()
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	rgba := img.(*image.RGBA)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			red := rgba.RGBAAt(x, y).R
+			if filled := x < 2; filled != (red != 0) {
+				t.Errorf("pixel %d,%d has red %d, want it filled = %v", x, y, red, filled)
+			}
+		}
+	}
+
+	// A 2x2 frame does not fit a 4x1 chunk, though it holds as many samples
+	if _, err := rawWithChunk(4, 1).render(); err == nil {
+		t.Errorf("render of a frame taller than its chunk succeeded")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransientReadError reports whether a read failed in a way that a worn
+// card or a flaky reader can recover from on a new try
+func isTransientReadError(err error) bool {
+	return errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EBUSY)
+}
+
+// isDiskGoneError reports whether a read failed because the disk is no
+// longer there
+func isDiskGoneError(err error) bool {
+	return errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.ENOTCONN)
+}
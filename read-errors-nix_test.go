@@ -0,0 +1,8 @@
+//go:build darwin || linux
+
+package main
+
+import "syscall"
+
+// errTransientRead is a read error that a retry may recover from
+var errTransientRead error = syscall.EIO
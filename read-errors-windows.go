@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isTransientReadError reports whether a read failed in a way that a worn
+// card or a flaky reader can recover from on a new try
+func isTransientReadError(err error) bool {
+	return errors.Is(err, windows.ERROR_CRC) ||
+		errors.Is(err, windows.ERROR_IO_DEVICE) ||
+		errors.Is(err, windows.ERROR_SEM_TIMEOUT) ||
+		errors.Is(err, windows.ERROR_GEN_FAILURE) ||
+		errors.Is(err, windows.ERROR_SECTOR_NOT_FOUND) ||
+		errors.Is(err, windows.ERROR_READ_FAULT)
+}
+
+// isDiskGoneError reports whether a read failed because the disk is no
+// longer there
+func isDiskGoneError(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_READY) ||
+		errors.Is(err, windows.ERROR_DEVICE_NOT_CONNECTED) ||
+		errors.Is(err, windows.ERROR_DEV_NOT_EXIST) ||
+		errors.Is(err, windows.ERROR_NO_MEDIA_IN_DRIVE)
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// errTransientRead is a read error that a retry may recover from
+var errTransientRead error = windows.ERROR_CRC
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// readAttempts is how many times a read failing with a transient error is
+// tried before the file is reported unreadable
+const readAttempts = 5
+
+// The wait before the first retry, doubled for each retry after it. Tests
+// shorten them.
+var (
+	readRetryDelay    = 250 * time.Millisecond
+	readRetryMaxDelay = 4 * time.Second
+)
+
+// errDiskRemoved cancels the imports from a disk that was removed
+var errDiskRemoved = errors.New("the disk was removed during the import")
+
+// retryRead runs read until it succeeds, fails with an error that is not
+// transient, or has been tried readAttempts times, waiting longer between
+// each try. It returns how many reads failed with a transient error.
+func retryRead(ctx context.Context, read func() error) (int, error) {
+	delay := readRetryDelay
+
+	var err error
+	failed := 0
+	for attempt := 0; attempt < readAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			if ctx.Err() != nil {
+				return failed, context.Cause(ctx)
+			}
+			delay = min(delay*2, readRetryMaxDelay)
+		}
+
+		err = read()
+		if err == nil || !isTransientReadError(err) {
+			return failed, err
+		}
+		failed++
+	}
+
+	return failed, err
+}
+
+// readFileRetrying reads a whole file, retrying transient read errors
+func readFileRetrying(ctx context.Context, path string) ([]byte, int, error) {
+	var data []byte
+	retries, err := retryRead(ctx, func() error {
+		var err error
+		data, err = os.ReadFile(path)
+		return err
+	})
+	return data, retries, err
+}
+
+// hashFileRetrying hashes a file, retrying transient read errors
+func hashFileRetrying(ctx context.Context, path string) (string, int, error) {
+	var hash string
+	retries, err := retryRead(ctx, func() error {
+		var err error
+		hash, err = hashFile(path)
+		return err
+	})
+	return hash, retries, err
+}
+
+// importTracker lets the imports from a disk be cancelled when it is removed
+type importTracker struct {
+	mu      sync.Mutex
+	next    int
+	imports map[int]trackedImport
+}
+
+type trackedImport struct {
+	source string
+	cancel context.CancelCauseFunc
+}
+
+// trackImport returns a context for an import from source, which is cancelled
+// with errDiskRemoved if the disk holding source is removed. done must be
+// called when the import ends.
+func (a *App) trackImport(ctx context.Context, source string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	a.importTracker.mu.Lock()
+	defer a.importTracker.mu.Unlock()
+
+	if a.importTracker.imports == nil {
+		a.importTracker.imports = map[int]trackedImport{}
+	}
+	id := a.importTracker.next
+	a.importTracker.next++
+	a.importTracker.imports[id] = trackedImport{source: source, cancel: cancel}
+
+	return ctx, func() {
+		a.importTracker.mu.Lock()
+		delete(a.importTracker.imports, id)
+		a.importTracker.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// abortImportsFrom cancels the imports reading from the disk at mountPoint
+func (a *App) abortImportsFrom(mountPoint string) {
+	a.importTracker.mu.Lock()
+	defer a.importTracker.mu.Unlock()
+
+	for _, tracked := range a.importTracker.imports {
+		if tracked.source != "" && isOnDisk(tracked.source, mountPoint) {
+			tracked.cancel(errDiskRemoved)
+		}
+	}
+}
+
+// importStopped explains why an import stopped before file, as the disk may
+// have been removed rather than the import cancelled
+func importStopped(ctx context.Context, file string) error {
+	if errors.Is(context.Cause(ctx), errDiskRemoved) {
+		return fmt.Errorf("stopped before %s: %w", file, errDiskRemoved)
+	}
+	return fmt.Errorf("import cancelled")
+}
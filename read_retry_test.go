@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetryRead(t *testing.T) {
+	transient := &fs.PathError{Op: "read", Path: "IMG_0001.CR3", Err: errTransientRead}
+
+	tests := []struct {
+		name string
+		// errs are returned by the reads in turn, then nil
+		errs        []error
+		cause       error
+		wantRetries int
+		wantReads   int
+		wantErr     error
+	}{
+		{
+			name:      "first read succeeds",
+			wantReads: 1,
+		},
+		{
+			name:        "transient errors recover",
+			errs:        []error{transient, transient},
+			wantRetries: 2,
+			wantReads:   3,
+		},
+		{
+			name:      "other errors are not retried",
+			errs:      []error{os.ErrNotExist},
+			wantReads: 1,
+			wantErr:   os.ErrNotExist,
+		},
+		{
+			name:        "transient errors give up",
+			errs:        []error{transient, transient, transient, transient, transient},
+			wantRetries: readAttempts,
+			wantReads:   readAttempts,
+			wantErr:     errTransientRead,
+		},
+		{
+			name:        "removing the disk stops the retries",
+			errs:        []error{transient, transient},
+			cause:       errDiskRemoved,
+			wantRetries: 1,
+			wantReads:   1,
+			wantErr:     errDiskRemoved,
+		},
+	}
+
+	delay, maxDelay := readRetryDelay, readRetryMaxDelay
+	readRetryDelay, readRetryMaxDelay = 0, 0
+	defer func() { readRetryDelay, readRetryMaxDelay = delay, maxDelay }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			reads := 0
+			retries, err := retryRead(ctx, func() error {
+				reads++
+				if tt.cause != nil {
+					cancel(tt.cause)
+				}
+				if reads <= len(tt.errs) {
+					return tt.errs[reads-1]
+				}
+				return nil
+			})
+
+			if retries != tt.wantRetries || reads != tt.wantReads {
+				t.Errorf("retryRead retried %d times in %d reads, want %d in %d", retries, reads, tt.wantRetries, tt.wantReads)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retryRead = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAbortImportsFrom(t *testing.T) {
+	card := filepath.Join(string(filepath.Separator), "media", "card")
+	other := filepath.Join(string(filepath.Separator), "media", "other")
+
+	a := &App{}
+	onCard, doneCard := a.trackImport(context.Background(), card)
+	defer doneCard()
+	onOther, doneOther := a.trackImport(context.Background(), other)
+	defer doneOther()
+
+	a.abortImportsFrom(card)
+
+	if !errors.Is(context.Cause(onCard), errDiskRemoved) {
+		t.Errorf("import from the removed card ended with %v, want %v", context.Cause(onCard), errDiskRemoved)
+	}
+	if !errors.Is(importStopped(onCard, "IMG_0001.CR3"), errDiskRemoved) {
+		t.Errorf("importStopped = %v, want %v", importStopped(onCard, "IMG_0001.CR3"), errDiskRemoved)
+	}
+	if onOther.Err() != nil {
+		t.Errorf("import from another card was stopped: %v", context.Cause(onOther))
+	}
+}
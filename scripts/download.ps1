@@ -55,4 +55,12 @@ try {
     exit 1
 }
 
+# Write the manifest used to verify the extracted files at runtime
+Write-Host "Writing WINDOWS manifest..."
+go run scripts/manifest.go assets/windows
+if ($LASTEXITCODE -ne 0) {
+    Write-Host "Failed to write WINDOWS manifest"
+    exit 1
+}
+
 Write-Host "WINDOWS download and extraction completed successfully!"
@@ -41,4 +41,14 @@ else
 	exit 1
 fi
 
+
+# Write the manifest used to verify the extracted files at runtime
+echo "Writing NIX manifest..."
+if go run scripts/manifest.go assets/nix; then
+	echo "Successfully wrote assets/nix.sha256"
+else
+	echo "Failed to write NIX manifest"
+	exit 1
+fi
+
 echo "NIX download and extraction completed successfully!"
@@ -0,0 +1,66 @@
+//go:build ignore
+
+// Writes a SHA-256 manifest of an exiftool distribution next to it, which is
+// embedded into the application and used to verify the extracted files.
+//
+//	go run scripts/manifest.go assets/nix
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("usage: go run scripts/manifest.go <exiftool directory>")
+		os.Exit(1)
+	}
+
+	dir := strings.TrimSuffix(os.Args[1], "/")
+	root := os.DirFS(dir)
+
+	var lines []string
+	err := fs.WalkDir(root, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Match go:embed, which skips hidden files below the top level
+		name := path.Base(p)
+		if p != "." && strings.Contains(p, "/") && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(root, p)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, fmt.Sprintf("%x  %s", sha256.Sum256(data), p))
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Failed to hash %s: %v\n", dir, err)
+		os.Exit(1)
+	}
+
+	manifest := dir + ".sha256"
+	if err := os.WriteFile(manifest, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		fmt.Printf("Failed to write %s: %v\n", manifest, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote %d hashes to %s\n", len(lines), manifest)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	sharpnessSuffix = ".sharpness.json"
+
+	// Spread of the weighting around the focus point, and around the centre
+	// when there is none, as a fraction of the shorter side of the preview
+	focusPointSigma = 0.1
+	centreSigma     = 0.25
+
+	// stackMaxGap is the longest time between two shots of the same stack
+	stackMaxGap = 2 * time.Second
+)
+
+type SharpnessScore struct {
+	Hash      string  `json:"hash"`
+	Sharpness float64 `json:"sharpness"`
+	// Whether the score is weighted around the AF point rather than the centre
+	FocusPoint bool `json:"focus_point"`
+}
+
+// focusPoint is a position in the unrotated image, from 0 to 1 on each axis
+type focusPoint struct {
+	X, Y float64
+}
+
+// readFocusPoint reads the AF point a shot was focused on from the maker
+// notes, where exiftool knows where to find it for the camera
+func readFocusPoint(path string) (focusPoint, bool) {
+	cmd, err := exiftoolCommand("-j", "-n", "-FocusLocation", "-AFAreaXPosition", "-AFAreaYPosition", "-AFImageWidth", "-AFImageHeight", path)
+	if err != nil {
+		return focusPoint{}, false
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return focusPoint{}, false
+	}
+
+	var results []map[string]interface{}
+	if err := json.Unmarshal(output, &results); err != nil || len(results) == 0 {
+		return focusPoint{}, false
+	}
+	tags := results[0]
+
+	// Sony: image width, image height, focus x, focus y
+	if location, ok := tags["FocusLocation"].(string); ok {
+		fields := strings.Fields(location)
+		if len(fields) == 4 {
+			var values [4]float64
+			valid := true
+			for i, field := range fields {
+				value, err := strconv.ParseFloat(field, 64)
+				valid = valid && err == nil
+				values[i] = value
+			}
+			if valid && values[0] > 0 && values[1] > 0 && (values[2] > 0 || values[3] > 0) {
+				return focusPoint{X: values[2] / values[0], Y: values[3] / values[1]}, true
+			}
+		}
+	}
+
+	// Nikon: area position in an AF image of the given size
+	x, okX := tags["AFAreaXPosition"].(float64)
+	y, okY := tags["AFAreaYPosition"].(float64)
+	width, okW := tags["AFImageWidth"].(float64)
+	height, okH := tags["AFImageHeight"].(float64)
+	if okX && okY && okW && okH && width > 0 && height > 0 && (x > 0 || y > 0) {
+		return focusPoint{X: x / width, Y: y / height}, true
+	}
+
+	return focusPoint{}, false
+}
+
+// oriented maps the point to the image displayed upright for the orientation,
+// matching orientImage
+func (p focusPoint) oriented(orientation int) focusPoint {
+	switch orientation {
+	case 2:
+		return focusPoint{1 - p.X, p.Y}
+	case 3:
+		return focusPoint{1 - p.X, 1 - p.Y}
+	case 4:
+		return focusPoint{p.X, 1 - p.Y}
+	case 5:
+		return focusPoint{p.Y, p.X}
+	case 6:
+		return focusPoint{1 - p.Y, p.X}
+	case 7:
+		return focusPoint{1 - p.Y, 1 - p.X}
+	case 8:
+		return focusPoint{p.Y, 1 - p.X}
+	}
+	return p
+}
+
+// laplacianVariance returns the variance of the Laplacian of the luma of img,
+// with pixels weighted by a Gaussian around centre. Sharp detail gives strong
+// second derivatives, so a higher variance means a sharper image.
+func laplacianVariance(img image.Image, centre focusPoint, sigma float64) float64 {
+	rgba := toRGBA(img)
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if width < 3 || height < 3 {
+		return 0
+	}
+
+	luma := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*rgba.Stride + x*4
+			luma[y*width+x] = 0.2126*float64(rgba.Pix[i]) + 0.7152*float64(rgba.Pix[i+1]) + 0.0722*float64(rgba.Pix[i+2])
+		}
+	}
+
+	cx, cy := centre.X*float64(width), centre.Y*float64(height)
+	s := sigma * float64(min(width, height))
+	twoSigma2 := 2 * s * s
+
+	var sumW, sum, sumSq float64
+	for y := 1; y < height-1; y++ {
+		dy := float64(y) - cy
+		for x := 1; x < width-1; x++ {
+			dx := float64(x) - cx
+			weight := math.Exp(-(dx*dx + dy*dy) / twoSigma2)
+			if weight < 1e-4 {
+				continue
+			}
+
+			i := y*width + x
+			laplacian := luma[i-width] + luma[i+width] + luma[i-1] + luma[i+1] - 4*luma[i]
+
+			sumW += weight
+			sum += weight * laplacian
+			sumSq += weight * laplacian * laplacian
+		}
+	}
+
+	if sumW == 0 {
+		return 0
+	}
+
+	mean := sum / sumW
+	return sumSq/sumW - mean*mean
+}
+
+// scoreSharpness scores the preview of a file, caching the score with the
+// thumbnail
+func (a *App) scoreSharpness(path string, source string) (SharpnessScore, error) {
+	preview, err := a.getSourcePreview(path, source)
+	if err != nil {
+		return SharpnessScore{}, err
+	}
+	if !preview.PreviewAvailable {
+		return SharpnessScore{}, errNoPreview
+	}
+
+	hash := preview.Hash
+	cacheDir := thumbnailCacheDir()
+	scorePath := filepath.Join(cacheDir, hash+sharpnessSuffix)
+
+	var score SharpnessScore
+	if data, err := os.ReadFile(scorePath); err == nil && json.Unmarshal(data, &score) == nil {
+		a.cache.lookup(CacheKindThumbnail, hash+sharpnessSuffix, true)
+		return score, nil
+	}
+	a.cache.lookup(CacheKindThumbnail, hash+sharpnessSuffix, false)
+
+	data, err := os.ReadFile(preview.PreviewPath)
+	if err != nil {
+		return SharpnessScore{}, fmt.Errorf("failed to read preview: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return SharpnessScore{}, fmt.Errorf("failed to decode preview: %v", err)
+	}
+
+	centre, sigma := focusPoint{X: 0.5, Y: 0.5}, centreSigma
+	point, hasPoint := readFocusPoint(path)
+	if hasPoint {
+		// The preview is stored upright
+		centre, sigma = point.oriented(preview.Orientation), focusPointSigma
+	}
+
+	score = SharpnessScore{
+		Hash:       hash,
+		Sharpness:  laplacianVariance(img, centre, sigma),
+		FocusPoint: hasPoint,
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return SharpnessScore{}, fmt.Errorf("failed to create thumbnail directory: %v", err)
+	}
+
+	encoded, err := json.Marshal(score)
+	if err != nil {
+		return SharpnessScore{}, fmt.Errorf("failed to encode sharpness: %v", err)
+	}
+
+	if err := writeFileAtomic(scorePath, encoded, 0644); err != nil {
+		rt.LogWarningf(a.ctx, "failed to cache sharpness for %q: %v", path, err)
+	} else {
+		a.cache.add(CacheKindThumbnail, hash, hash+sharpnessSuffix, source)
+	}
+
+	return score, nil
+}
+
+// ScoreSharpness fills in the sharpness of each file from its embedded
+// preview. Files without a preview keep a sharpness of 0.
+func (a *App) ScoreSharpness(files []FileInfo) []FileInfo {
+	source := a.browsedSource()
+
+	scored := make([]FileInfo, len(files))
+	for i, file := range files {
+		scored[i] = file
+
+		score, err := a.scoreSharpness(file.Path, source)
+		if err != nil {
+			rt.LogWarningf(a.ctx, "failed to score sharpness of %q: %v", file.Path, err)
+			continue
+		}
+
+		scored[i].Sharpness = score.Sharpness
+	}
+
+	return scored
+}
+
+// groupStacks splits files into stacks of shots taken less than stackMaxGap
+// apart, in capture order. Files without a capture time are a stack each.
+func (a *App) groupStacks(files []FileInfo) [][]FileInfo {
+	type timedFile struct {
+		file FileInfo
+		time time.Time
+	}
+
+	var timed []timedFile
+	var stacks [][]FileInfo
+	for _, file := range files {
+		captured, err := readCaptureTime(file.Path, time.Local)
+		if err != nil {
+			rt.LogWarningf(a.ctx, "no capture time for %q: %v", file.Path, err)
+			stacks = append(stacks, []FileInfo{file})
+			continue
+		}
+		timed = append(timed, timedFile{file: file, time: captured})
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].time.Before(timed[j].time)
+	})
+
+	for i, t := range timed {
+		if i == 0 || t.time.Sub(timed[i-1].time) > stackMaxGap {
+			stacks = append(stacks, nil)
+		}
+		stacks[len(stacks)-1] = append(stacks[len(stacks)-1], t.file)
+	}
+
+	return stacks
+}
+
+// SelectSharpest returns the n sharpest files of each stack of shots, scoring
+// the files first
+func (a *App) SelectSharpest(files []FileInfo, n int) []FileInfo {
+	if n <= 0 {
+		return nil
+	}
+
+	var selected []FileInfo
+	for _, stack := range a.groupStacks(a.ScoreSharpness(files)) {
+		sort.SliceStable(stack, func(i, j int) bool {
+			return stack[i].Sharpness > stack[j].Sharpness
+		})
+
+		selected = append(selected, stack[:min(n, len(stack))]...)
+	}
+
+	rt.LogDebugf(a.ctx, "Selected the %d sharpest of each stack: %d of %d files", n, len(selected), len(files))
+
+	return selected
+}
+
+func (a *App) selectSharpest() {
+	rt.EventsEmit(a.ctx, "select-sharpest")
+	rt.LogDebug(a.ctx, "Select sharpest event emitted")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	dHashSuffix = ".dhash"
+
+	// similarMaxDistance is the largest number of differing bits between
+	// the dHashes of two images considered the same composition
+	similarMaxDistance = 10
+)
+
+// dHash computes the difference hash of img: it is shrunk to 9x8 grey pixels
+// and each bit records whether a pixel is brighter than its right neighbour.
+// Similar images have hashes differing in few bits.
+func dHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	rgba := toRGBA(img)
+	srcW, srcH := rgba.Rect.Dx(), rgba.Rect.Dy()
+
+	var grey [height][width]float64
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcH/height, max((y+1)*srcH/height, y*srcH/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcW/width, max((x+1)*srcW/width, x*srcW/width+1)
+
+			var sum float64
+			var count int
+			for sy := y0; sy < min(y1, srcH); sy++ {
+				for sx := x0; sx < min(x1, srcW); sx++ {
+					i := sy*rgba.Stride + sx*4
+					sum += 0.2126*float64(rgba.Pix[i]) + 0.7152*float64(rgba.Pix[i+1]) + 0.0722*float64(rgba.Pix[i+2])
+					count++
+				}
+			}
+			if count > 0 {
+				grey[y][x] = sum / float64(count)
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// thumbnailDHash returns the dHash of a cached thumbnail, computing it and
+// caching it next to the thumbnail the first time
+func (a *App) thumbnailDHash(hash string, source string) (string, error) {
+	cacheDir := thumbnailCacheDir()
+	dHashPath := filepath.Join(cacheDir, hash+dHashSuffix)
+
+	if data, err := os.ReadFile(dHashPath); err == nil {
+		a.cache.touch(CacheKindThumbnail, hash+dHashSuffix)
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, hash+".jpg"))
+	if err != nil {
+		return "", err
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode thumbnail: %v", err)
+	}
+
+	value := fmt.Sprintf("%016x", dHash(img))
+
+	if err := writeFileAtomic(dHashPath, []byte(value), 0644); err != nil {
+		rt.LogWarningf(a.ctx, "failed to cache dHash of %s: %v", hash, err)
+	} else {
+		a.cache.add(CacheKindThumbnail, hash, hash+dHashSuffix, source)
+	}
+
+	return value, nil
+}
+
+// ClusterSimilar assigns a cluster ID to each file, shared by the files whose
+// thumbnails look alike, such as several shots of the same composition.
+// Cluster IDs start at 1 and files without a thumbnail are alone in theirs.
+func (a *App) ClusterSimilar(files []FileInfo) []FileInfo {
+	hashes := make([]uint64, len(files))
+	hasHash := make([]bool, len(files))
+
+	for i, file := range files {
+		thumbnail, err := a.ExtractThumbnail(file.Path)
+		if err != nil || !thumbnail.PreviewAvailable {
+			continue
+		}
+
+		value, err := strconv.ParseUint(thumbnail.PerceptualHash, 16, 64)
+		if err != nil {
+			continue
+		}
+
+		hashes[i] = value
+		hasHash[i] = true
+	}
+
+	// Union-find over every pair of similar thumbnails
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range files {
+		if !hasHash[i] {
+			continue
+		}
+		for j := i + 1; j < len(files); j++ {
+			if hasHash[j] && bits.OnesCount64(hashes[i]^hashes[j]) <= similarMaxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clustered := make([]FileInfo, len(files))
+	clusterIDs := map[int]int{}
+	for i, file := range files {
+		root := find(i)
+		if _, ok := clusterIDs[root]; !ok {
+			clusterIDs[root] = len(clusterIDs) + 1
+		}
+
+		clustered[i] = file
+		clustered[i].ClusterID = clusterIDs[root]
+	}
+
+	rt.LogDebugf(a.ctx, "Clustered %d files into %d groups of similar images", len(files), len(clusterIDs))
+
+	return clustered
+}
+
+// SelectClusterRepresentatives returns one file per cluster of similar
+// images: the sharpest when files have been scored, otherwise the first.
+// Files are clustered first if they have no cluster ID yet.
+func (a *App) SelectClusterRepresentatives(files []FileInfo) []FileInfo {
+	for _, file := range files {
+		if file.ClusterID == 0 {
+			files = a.ClusterSimilar(files)
+			break
+		}
+	}
+
+	var selected []FileInfo
+	chosen := map[int]int{}
+	for _, file := range files {
+		i, ok := chosen[file.ClusterID]
+		if !ok {
+			chosen[file.ClusterID] = len(selected)
+			selected = append(selected, file)
+			continue
+		}
+
+		if file.Sharpness > selected[i].Sharpness {
+			selected[i] = file
+		}
+	}
+
+	return selected
+}
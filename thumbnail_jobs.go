@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Number of thumbnails generated in parallel by a thumbnail job
+var thumbnailWorkers = max(1, min(runtime.NumCPU(), 4))
+
+var thumbnailJobCounter atomic.Int64
+
+type ThumbnailReadyEvent struct {
+	JobID     string            `json:"job_id"`
+	Thumbnail ThumbnailResponse `json:"thumbnail"`
+	Done      int               `json:"done"`
+	Total     int               `json:"total"`
+}
+
+type ThumbnailFailedEvent struct {
+	JobID string `json:"job_id"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+type ThumbnailJobEvent struct {
+	JobID string `json:"job_id"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// thumbnailJob generates thumbnails for a list of files in the background.
+// Pending files are kept in priority order and can be reordered while the
+// job runs.
+type thumbnailJob struct {
+	id     string
+	source string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	pending []string
+	total   int
+	done    int
+}
+
+func (j *thumbnailJob) next() (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.pending) == 0 || j.ctx.Err() != nil {
+		return "", false
+	}
+
+	path := j.pending[0]
+	j.pending = j.pending[1:]
+
+	return path, true
+}
+
+func (j *thumbnailJob) finish() (int, int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.done++
+	return j.done, j.total
+}
+
+// prioritize moves the given paths to the front of the queue, in order
+func (j *thumbnailJob) prioritize(paths []string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+
+	var first, rest []string
+	queued := make(map[string]bool, len(j.pending))
+	for _, path := range j.pending {
+		queued[path] = true
+		if !wanted[path] {
+			rest = append(rest, path)
+		}
+	}
+
+	for _, path := range paths {
+		if queued[path] {
+			first = append(first, path)
+			delete(queued, path)
+		}
+	}
+
+	j.pending = append(first, rest...)
+}
+
+func (j *thumbnailJob) run(a *App) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < thumbnailWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				path, ok := j.next()
+				if !ok {
+					return
+				}
+
+				thumbnail, err := a.extractSourceThumbnail(path, j.source)
+				done, total := j.finish()
+
+				if j.ctx.Err() != nil {
+					return
+				}
+
+				if err != nil {
+					rt.EventsEmit(a.ctx, "thumbnail:failed", ThumbnailFailedEvent{
+						JobID: j.id,
+						Path:  path,
+						Error: err.Error(),
+						Done:  done,
+						Total: total,
+					})
+					continue
+				}
+
+				rt.EventsEmit(a.ctx, "thumbnail:ready", ThumbnailReadyEvent{
+					JobID:     j.id,
+					Thumbnail: thumbnail,
+					Done:      done,
+					Total:     total,
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := a.cache.save(); err != nil {
+		rt.LogErrorf(a.ctx, "failed to save the cache index: %v", err)
+	}
+
+	j.mu.Lock()
+	event := ThumbnailJobEvent{JobID: j.id, Done: j.done, Total: j.total}
+	j.mu.Unlock()
+
+	if j.ctx.Err() != nil {
+		rt.LogDebugf(a.ctx, "Thumbnail job %s cancelled after %d of %d files", j.id, event.Done, event.Total)
+		rt.EventsEmit(a.ctx, "thumbnail:cancelled", event)
+		return
+	}
+
+	rt.LogDebugf(a.ctx, "Thumbnail job %s finished %d files", j.id, event.Total)
+	rt.EventsEmit(a.ctx, "thumbnail:done", event)
+	j.cancel()
+}
+
+// StartThumbnailJob generates thumbnails for paths in the background, in the
+// given order, emitting a thumbnail:ready event for each. Any job already
+// running is cancelled.
+func (a *App) StartThumbnailJob(paths []string) string {
+	a.thumbnailJobMu.Lock()
+	defer a.thumbnailJobMu.Unlock()
+
+	if a.thumbnailJob != nil {
+		a.thumbnailJob.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	job := &thumbnailJob{
+		id:      fmt.Sprintf("thumbnails-%d", thumbnailJobCounter.Add(1)),
+		source:  a.currentSource,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: append([]string(nil), paths...),
+		total:   len(paths),
+	}
+	a.thumbnailJob = job
+
+	rt.LogDebugf(a.ctx, "Starting thumbnail job %s for %d files", job.id, job.total)
+	go job.run(a)
+
+	return job.id
+}
+
+// PrioritizeThumbnails moves paths, for example the ones currently visible, to
+// the front of the queue of a running job
+func (a *App) PrioritizeThumbnails(jobID string, paths []string) {
+	a.thumbnailJobMu.Lock()
+	defer a.thumbnailJobMu.Unlock()
+
+	if a.thumbnailJob != nil && a.thumbnailJob.id == jobID {
+		a.thumbnailJob.prioritize(paths)
+	}
+}
+
+func (a *App) CancelThumbnailJob(jobID string) {
+	a.thumbnailJobMu.Lock()
+	defer a.thumbnailJobMu.Unlock()
+
+	if a.thumbnailJob != nil && a.thumbnailJob.id == jobID {
+		a.thumbnailJob.cancel()
+		a.thumbnailJob = nil
+	}
+}
+
+// browsedSource returns the source being browsed
+func (a *App) browsedSource() string {
+	a.thumbnailJobMu.Lock()
+	defer a.thumbnailJobMu.Unlock()
+
+	return a.currentSource
+}
+
+// setCurrentSource records the source being browsed, cancelling the running
+// job if it was started for a different source
+func (a *App) setCurrentSource(source string) {
+	a.thumbnailJobMu.Lock()
+	defer a.thumbnailJobMu.Unlock()
+
+	a.currentSource = source
+
+	if a.thumbnailJob != nil && a.thumbnailJob.source != source {
+		a.thumbnailJob.cancel()
+		a.thumbnailJob = nil
+	}
+}
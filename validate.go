@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// A file smaller than this fraction of the median size of its siblings
+	// was probably cut short, e.g. when the battery died during the write
+	truncatedSizeRatio = 0.5
+
+	// Fewer siblings than this give no meaningful median
+	minSiblingsForSize = 3
+)
+
+// Exiftool warnings and errors that point at damaged files rather than
+// unusual but valid ones
+var damagedFileRegexp = regexp.MustCompile(`(?i)truncat|corrupt|unexpected end|bad .*(offset|size|format|directory|ifd)|not a valid|missing .*(ifd|data)|error reading`)
+
+// siblingKey groups the files written by the same camera in the same way:
+// cameras keep a folder per camera, and one raw format each
+func siblingKey(path string) string {
+	dir := path
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		dir = path[:i]
+	}
+	return dir + "\x00" + strings.ToLower(filepath.Ext(path))
+}
+
+// sizeWarnings flags the files of zero size and those far smaller than their
+// siblings, which only needs the listing
+func sizeWarnings(files []FileInfo) map[string][]string {
+	groups := map[string][]int64{}
+	for _, file := range files {
+		if file.Size > 0 {
+			key := siblingKey(file.Path)
+			groups[key] = append(groups[key], file.Size)
+		}
+	}
+
+	medians := map[string]int64{}
+	for key, sizes := range groups {
+		if len(sizes) < minSiblingsForSize {
+			continue
+		}
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+		medians[key] = sizes[len(sizes)/2]
+	}
+
+	warnings := map[string][]string{}
+	for _, file := range files {
+		if file.Size == 0 {
+			warnings[file.Path] = append(warnings[file.Path], "The file is empty")
+			continue
+		}
+
+		median, ok := medians[siblingKey(file.Path)]
+		if ok && float64(file.Size) < truncatedSizeRatio*float64(median) {
+			warnings[file.Path] = append(warnings[file.Path], fmt.Sprintf("The file is %d%% of the usual size of its siblings and may be truncated", file.Size*100/median))
+		}
+	}
+
+	return warnings
+}
+
+// flagSuspicious adds warnings to the files, marking those with any as
+// suspicious
+func flagSuspicious(files []FileInfo, warnings map[string][]string) {
+	for i := range files {
+		if found := warnings[files[i].Path]; len(found) > 0 {
+			files[i].Warnings = append(files[i].Warnings, found...)
+			files[i].Suspicious = true
+		}
+	}
+}
+
+// exiftoolWarnings reads the warnings and errors exiftool has about each
+// file, keeping those about damaged data. local maps the files to read to the
+// paths the warnings are reported for, which differ for files on cameras.
+func exiftoolWarnings(local map[string]string) (map[string][]string, error) {
+	warnings := map[string][]string{}
+	if len(local) == 0 {
+		return warnings, nil
+	}
+
+	// The paths are passed in an argument file on stdin, as a card holds more
+	// than fit on a command line
+	var argfile strings.Builder
+	for file := range local {
+		argfile.WriteString(file)
+		argfile.WriteByte('\n')
+	}
+
+	cmd, err := exiftoolCommand("-charset", "filename=utf8", "-j", "-Warning", "-Error", "-@", "-")
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = strings.NewReader(argfile.String())
+
+	// exiftool exits with an error when a file has errors, which is reported
+	// in the output along with the others
+	output, err := cmd.Output()
+	if len(output) == 0 && err != nil {
+		return nil, fmt.Errorf("exiftool failed: %v", err)
+	}
+
+	var results []struct {
+		SourceFile string
+		Warning    string
+		Error      string
+	}
+	if err := json.Unmarshal(output, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse exiftool output: %v", err)
+	}
+
+	for _, result := range results {
+		path, ok := local[result.SourceFile]
+		if !ok {
+			path, ok = local[filepath.FromSlash(result.SourceFile)]
+		}
+		if !ok {
+			continue
+		}
+
+		for _, message := range []string{result.Error, result.Warning} {
+			if message != "" && damagedFileRegexp.MatchString(message) {
+				warnings[path] = append(warnings[path], "exiftool: "+message)
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// previewWarning explains what is wrong with the preview of a file, or
+// returns "" when it could be read and decoded
+func previewWarning(thumbnail ThumbnailResponse, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("The preview cannot be read: %v", err)
+	case !thumbnail.PreviewAvailable:
+		return "The file has no preview and its raw data cannot be decoded"
+	case thumbnail.PerceptualHash == "":
+		return "The preview cannot be decoded"
+	}
+	return ""
+}
+
+// contentWarnings checks the embedded preview and the metadata of each file
+func (a *App) contentWarnings(files []FileInfo) map[string][]string {
+	warnings := map[string][]string{}
+
+	local := map[string]string{}
+	for _, file := range files {
+		if file.Size == 0 {
+			continue
+		}
+
+		if warning := previewWarning(a.ExtractThumbnail(file.Path)); warning != "" {
+			warnings[file.Path] = append(warnings[file.Path], warning)
+		}
+
+		// Files on cameras are checked in their downloaded copy
+		if !isCameraPath(file.Path) {
+			local[file.Path] = file.Path
+		} else if staged, err := stageCameraFile(a.ctx, file.Path); err == nil {
+			local[staged] = file.Path
+		}
+	}
+
+	found, err := exiftoolWarnings(local)
+	if err != nil {
+		rt.LogWarningf(a.ctx, "failed to check files with exiftool: %v", err)
+	}
+	for path, messages := range found {
+		warnings[path] = append(warnings[path], messages...)
+	}
+
+	return warnings
+}
+
+// ValidateFiles flags the files that look damaged, such as empty or truncated
+// raws left by a camera losing power, with the reasons in their warnings
+func (a *App) ValidateFiles(files []FileInfo) []FileInfo {
+	validated := make([]FileInfo, len(files))
+	for i, file := range files {
+		validated[i] = file
+		validated[i].Suspicious = false
+		validated[i].Warnings = nil
+	}
+
+	flagSuspicious(validated, sizeWarnings(validated))
+	flagSuspicious(validated, a.contentWarnings(validated))
+
+	suspicious := 0
+	for _, file := range validated {
+		if file.Suspicious {
+			suspicious++
+		}
+	}
+	rt.LogInfof(a.ctx, "%d of %d files look damaged", suspicious, len(files))
+
+	return validated
+}
+
+// suspiciousImports validates the files of an import, with their siblings on
+// the card to compare sizes against
+func (a *App) suspiciousImports(paths []string) map[string][]string {
+	var files []FileInfo
+	listed := map[string]bool{}
+	for _, path := range paths {
+		listed[path] = true
+	}
+
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		if isCameraPath(path) {
+			// The import downloads it anyway
+			staged, err := stageCameraFile(a.ctx, path)
+			if err != nil {
+				continue
+			}
+			if info, err := os.Stat(staged); err == nil {
+				files = append(files, FileInfo{Path: path, Size: info.Size()})
+			}
+			continue
+		}
+
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			sibling := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || !isAllowedExtension(sibling) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, FileInfo{Path: sibling, Size: info.Size()})
+		}
+	}
+
+	// Only the imported files are checked beyond their size
+	warnings := map[string][]string{}
+	var imported []FileInfo
+	for path, messages := range sizeWarnings(files) {
+		if listed[path] {
+			warnings[path] = messages
+		}
+	}
+	for _, file := range files {
+		if listed[file.Path] {
+			imported = append(imported, file)
+		}
+	}
+	for path, messages := range a.contentWarnings(imported) {
+		warnings[path] = append(warnings[path], messages...)
+	}
+
+	return warnings
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSizeWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []FileInfo
+		want  map[string]int // number of warnings by path
+	}{
+		{
+			name: "similar sizes",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 30 << 20},
+				{Path: "/card/DCIM/100/B.CR3", Size: 28 << 20},
+				{Path: "/card/DCIM/100/C.CR3", Size: 32 << 20},
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "empty file",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 0},
+			},
+			want: map[string]int{"/card/DCIM/100/A.CR3": 1},
+		},
+		{
+			name: "truncated file",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 30 << 20},
+				{Path: "/card/DCIM/100/B.CR3", Size: 28 << 20},
+				{Path: "/card/DCIM/100/C.CR3", Size: 32 << 20},
+				{Path: "/card/DCIM/100/D.CR3", Size: 4 << 20},
+			},
+			want: map[string]int{"/card/DCIM/100/D.CR3": 1},
+		},
+		{
+			name: "too few siblings to compare",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 30 << 20},
+				{Path: "/card/DCIM/100/D.CR3", Size: 4 << 20},
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "other formats are not siblings",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 30 << 20},
+				{Path: "/card/DCIM/100/B.CR3", Size: 28 << 20},
+				{Path: "/card/DCIM/100/C.CR3", Size: 32 << 20},
+				{Path: "/card/DCIM/100/A.JPG", Size: 4 << 20},
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "other folders are not siblings",
+			files: []FileInfo{
+				{Path: "/card/DCIM/100/A.CR3", Size: 30 << 20},
+				{Path: "/card/DCIM/100/B.CR3", Size: 28 << 20},
+				{Path: "/card/DCIM/100/C.CR3", Size: 32 << 20},
+				{Path: "/card/DCIM/101/D.CR3", Size: 4 << 20},
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "camera paths",
+			files: []FileInfo{
+				{Path: "camera://gphoto2/usb:001,005/DCIM/100/A.NEF", Size: 25 << 20},
+				{Path: "camera://gphoto2/usb:001,005/DCIM/100/B.NEF", Size: 25 << 20},
+				{Path: "camera://gphoto2/usb:001,005/DCIM/100/C.NEF", Size: 25 << 20},
+				{Path: "camera://gphoto2/usb:001,005/DCIM/100/D.NEF", Size: 1 << 20},
+			},
+			want: map[string]int{"camera://gphoto2/usb:001,005/DCIM/100/D.NEF": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]int{}
+			for path, warnings := range sizeWarnings(tt.files) {
+				got[path] = len(warnings)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sizeWarnings = %v, want %v", sizeWarnings(tt.files), tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagSuspicious(t *testing.T) {
+	files := []FileInfo{
+		{Path: "/card/A.CR3", Warnings: []string{"earlier"}},
+		{Path: "/card/B.CR3"},
+	}
+
+	flagSuspicious(files, map[string][]string{"/card/A.CR3": {"The file is empty"}})
+
+	if !files[0].Suspicious || !reflect.DeepEqual(files[0].Warnings, []string{"earlier", "The file is empty"}) {
+		t.Errorf("flagged file = %+v", files[0])
+	}
+	if files[1].Suspicious || len(files[1].Warnings) != 0 {
+		t.Errorf("file without warnings = %+v", files[1])
+	}
+}
+
+func TestPreviewWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		thumbnail ThumbnailResponse
+		err       error
+		wantWarn  bool
+	}{
+		{
+			name:      "decoded preview",
+			thumbnail: ThumbnailResponse{PreviewAvailable: true, PerceptualHash: "8f3c1e0077aa5511"},
+		},
+		{
+			name:     "unreadable file",
+			err:      errors.New("unexpected EOF"),
+			wantWarn: true,
+		},
+		{
+			name:      "no preview and no decodable raw data",
+			thumbnail: ThumbnailResponse{OriginalPath: "/card/A.CR3", Orientation: 1},
+			wantWarn:  true,
+		},
+		{
+			name:      "preview that cannot be decoded",
+			thumbnail: ThumbnailResponse{PreviewAvailable: true},
+			wantWarn:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if warning := previewWarning(tt.thumbnail, tt.err); (warning != "") != tt.wantWarn {
+				t.Errorf("previewWarning = %q, want a warning = %v", warning, tt.wantWarn)
+			}
+		})
+	}
+}
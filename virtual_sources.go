@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash"
+	rt "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// VirtualSource is a folder registered as a source, such as a NAS share, a
+// phone dump or a copy of a card
+type VirtualSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// virtualDisk describes a virtual source like a mounted partition. Its ID
+// comes from the path, as the volume holding it is shared with other folders.
+func virtualDisk(source VirtualSource) DiskInfo {
+	disk := DiskInfo{
+		Label:      source.Name,
+		Model:      "Folder",
+		MountPoint: source.Path,
+		Virtual:    true,
+	}
+	describeDisk(&disk)
+
+	disk.Size = disk.FreeSpace + disk.UsedSpace
+	disk.ID = fmt.Sprintf("%016x", xxhash.Sum64String("virtual\x00"+source.Path))
+
+	return disk
+}
+
+// virtualDisks lists the virtual sources whose folder can be read. Folders on
+// a share that is not mounted are left out until it is.
+func (a *App) virtualDisks() []DiskInfo {
+	var disks []DiskInfo
+	for _, source := range a.GetVirtualSources() {
+		if info, err := os.Stat(source.Path); err != nil || !info.IsDir() {
+			rt.LogDebugf(a.ctx, "Virtual source %s is not available at %s", source.Name, source.Path)
+			continue
+		}
+		disks = append(disks, virtualDisk(source))
+	}
+	return disks
+}
+
+// isVirtualSource reports whether path is a registered virtual source
+func (a *App) isVirtualSource(path string) bool {
+	for _, source := range a.GetVirtualSources() {
+		if source.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// findDisk returns the removable partition, virtual source or camera at
+// mountPoint
+func (a *App) findDisk(mountPoint string) (DiskInfo, bool) {
+	for _, disk := range listDisks() {
+		if disk.MountPoint == mountPoint {
+			describeDisk(&disk)
+			return disk, true
+		}
+	}
+
+	for _, source := range a.GetVirtualSources() {
+		if source.Path == mountPoint {
+			return virtualDisk(source), true
+		}
+	}
+
+	if isCameraPath(mountPoint) {
+		for _, disk := range a.cameraDisks() {
+			if disk.MountPoint == mountPoint {
+				return disk, true
+			}
+		}
+	}
+
+	return DiskInfo{}, false
+}
+
+func (a *App) GetVirtualSources() []VirtualSource {
+	configState := a.GetConfig()
+	if configState == nil {
+		return nil
+	}
+	return configState.VirtualSources
+}
+
+// AddVirtualSource registers a folder as a source named name, or after the
+// folder when name is empty
+func (a *App) AddVirtualSource(name string, path string) (DiskInfo, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return DiskInfo{}, fmt.Errorf("invalid folder %s: %v", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return DiskInfo{}, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return DiskInfo{}, fmt.Errorf("%s is not a folder", path)
+	}
+
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	sources := a.GetVirtualSources()
+	for _, source := range sources {
+		if source.Path == path {
+			return DiskInfo{}, fmt.Errorf("%s is already a source, as %s", path, source.Name)
+		}
+	}
+	sources = append(sources, VirtualSource{Name: name, Path: path})
+
+	if err := a.updateConfig(map[string]interface{}{"virtualSources": sources}); err != nil {
+		return DiskInfo{}, err
+	}
+
+	disk := virtualDisk(VirtualSource{Name: name, Path: path})
+	rt.LogInfof(a.ctx, "Added virtual source %s at %s", name, path)
+	rt.EventsEmit(a.ctx, "disk:added", disk)
+
+	return disk, nil
+}
+
+// RemoveVirtualSource forgets the virtual source at path. The folder itself
+// is left untouched.
+func (a *App) RemoveVirtualSource(path string) error {
+	var removed *VirtualSource
+	sources := []VirtualSource{}
+	for _, source := range a.GetVirtualSources() {
+		if source.Path == path {
+			removed = &source
+			continue
+		}
+		sources = append(sources, source)
+	}
+	if removed == nil {
+		return fmt.Errorf("%s is not a source", path)
+	}
+
+	if err := a.updateConfig(map[string]interface{}{"virtualSources": sources}); err != nil {
+		return err
+	}
+
+	rt.LogInfof(a.ctx, "Removed virtual source %s at %s", removed.Name, path)
+	rt.EventsEmit(a.ctx, "disk:removed", DiskInfo{
+		Label:      removed.Name,
+		Model:      "Folder",
+		MountPoint: removed.Path,
+		Virtual:    true,
+	})
+
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func statfsReadOnly(stat *unix.Statfs_t) bool {
+	return stat.Flags&unix.MNT_RDONLY != 0
+}
+
+func statfsType(stat *unix.Statfs_t) string {
+	return unix.ByteSliceToString(stat.Fstypename[:])
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func statfsReadOnly(stat *unix.Statfs_t) bool {
+	return stat.Flags&unix.ST_RDONLY != 0
+}
+
+// statfsType returns no type on Linux, where the filesystem type from udev
+// is used instead
+func statfsType(stat *unix.Statfs_t) string {
+	return ""
+}
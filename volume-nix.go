@@ -0,0 +1,50 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+func readVolumeInfo(mountPoint string, device string) (volumeInfo, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(mountPoint, &stat); err != nil {
+		return volumeInfo{}, err
+	}
+
+	volume := volumeInfo{
+		Free:     stat.Bavail * uint64(stat.Bsize),
+		Total:    stat.Blocks * uint64(stat.Bsize),
+		ReadOnly: statfsReadOnly(&stat),
+		Serial:   filesystemUUID(device),
+	}
+	volume.FilesystemType = statfsType(&stat)
+
+	return volume, nil
+}
+
+// filesystemUUID finds the filesystem UUID of a device from the udev links,
+// which for FAT and exFAT cards is the volume serial number. On macOS the
+// volume UUID already comes from ghw.
+func filesystemUUID(device string) string {
+	if device == "" {
+		return ""
+	}
+
+	links, err := os.ReadDir("/dev/disk/by-uuid")
+	if err != nil {
+		return ""
+	}
+
+	for _, link := range links {
+		target, err := os.Readlink(filepath.Join("/dev/disk/by-uuid", link.Name()))
+		if err == nil && filepath.Base(target) == device {
+			return link.Name()
+		}
+	}
+
+	return ""
+}
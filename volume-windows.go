@@ -0,0 +1,37 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+func readVolumeInfo(mountPoint string, device string) (volumeInfo, error) {
+	root := strings.TrimSuffix(mountPoint, `\`) + `\`
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+
+	var serial, maxComponent, flags uint32
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(rootPtr, nil, 0, &serial, &maxComponent, &flags, &fsName[0], uint32(len(fsName))); err != nil {
+		return volumeInfo{}, fmt.Errorf("failed to read volume information: %v", err)
+	}
+
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(rootPtr, &free, &total, &totalFree); err != nil {
+		return volumeInfo{}, fmt.Errorf("failed to read free space: %v", err)
+	}
+
+	return volumeInfo{
+		Serial:         fmt.Sprintf("%04X-%04X", serial>>16, serial&0xFFFF),
+		FilesystemType: windows.UTF16ToString(fsName),
+		Free:           free,
+		Total:          total,
+		ReadOnly:       flags&windows.FILE_READ_ONLY_VOLUME != 0,
+	}, nil
+}
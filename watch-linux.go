@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMounts signals when the mount table changes. The kernel marks
+// /proc/self/mountinfo with POLLPRI on every mount and unmount.
+func watchMounts(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return changes
+	}
+
+	go func() {
+		defer file.Close()
+
+		fds := []unix.PollFd{{Fd: int32(file.Fd()), Events: unix.POLLPRI}}
+		for ctx.Err() == nil {
+			n, err := unix.Poll(fds, int(diskPollInterval.Milliseconds()))
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if n == 0 || fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+				continue
+			}
+
+			// Reading the file acknowledges the change
+			if _, err := file.Seek(0, 0); err == nil {
+				buf := make([]byte, 64*1024)
+				for {
+					if n, err := file.Read(buf); n == 0 || err != nil {
+						break
+					}
+				}
+			}
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
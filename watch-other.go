@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "context"
+
+// watchMounts never signals, so the disks are polled every diskPollInterval.
+// This is on purpose: DiskArbitration on macOS needs cgo and a run loop, and
+// WM_DEVICECHANGE on Windows needs a window procedure, which the webview owns.
+// Listing the disks is cheap, and a card shows up within the interval.
+func watchMounts(ctx context.Context) <-chan struct{} {
+	return make(chan struct{})
+}